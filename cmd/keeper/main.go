@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/icyrogue/ye-keeper/internal/api"
 	"github.com/icyrogue/ye-keeper/internal/asyncstorageinterface"
 	cachemanager "github.com/icyrogue/ye-keeper/internal/cacheManager"
 	"github.com/icyrogue/ye-keeper/internal/client"
 	"github.com/icyrogue/ye-keeper/internal/componentanalyzer"
+	"github.com/icyrogue/ye-keeper/internal/costing"
 	"github.com/icyrogue/ye-keeper/internal/dbstorage"
+	"github.com/icyrogue/ye-keeper/internal/efind"
+	"github.com/icyrogue/ye-keeper/internal/jobs"
 	"github.com/icyrogue/ye-keeper/internal/multiencoder"
 	"github.com/icyrogue/ye-keeper/internal/notificationmanager"
 	"github.com/icyrogue/ye-keeper/internal/options"
+	"github.com/icyrogue/ye-keeper/internal/pricelist"
+	"github.com/icyrogue/ye-keeper/internal/pricing"
 	"github.com/icyrogue/ye-keeper/internal/queuemanager"
+	"github.com/icyrogue/ye-keeper/internal/regions"
 	"github.com/icyrogue/ye-keeper/internal/requestprocessor"
+	"github.com/icyrogue/ye-keeper/internal/scheduler"
 	"github.com/icyrogue/ye-keeper/internal/schemamanager"
 	"github.com/icyrogue/ye-keeper/internal/usermanager"
 )
@@ -31,7 +43,6 @@ func main() {
 	if err != nil {
 		log.Println(err.Error())
 	}
-	defer storage.Close()
 	userManager := usermanager.New(storage.GetPool())
 
 	notificationManager := notificationmanager.New(userManager, cfg.MailingOpts)
@@ -43,43 +54,131 @@ func main() {
 		log.Println(err.Error())
 	}
 
-	schemaManager := schemamanager.New(storage)
+	regions := regions.New()
+	regions.Options = cfg.RegionsOpts
+	err = regions.Init()
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	schemaManager := schemamanager.New(storage, regions)
 	schemaManager.Options = cfg.SchemaManagerOpts
 	err = schemaManager.Init()
 	if err != nil {
 		log.Println(err.Error())
 	}
 
-	output := make(chan []interface{}, 10)
-	ctx := context.Background()
+	output := make(chan []interface{}, cfg.AnalyzerOpts.Buffer)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	multiEncoder := multiencoder.New(schemaManager)
 	multiEncoder.StorageInterfaceInput = output
 
-	analyzer := componentanalyzer.New(multiEncoder, schemaManager)
+	analyzer := componentanalyzer.New(multiEncoder, schemaManager, *cfg.AnalyzerOpts)
 	multiEncoder.Output = analyzer.GetInput()
 
-	analyzer.Start(ctx, output)
+	analyzer.Start(output)
 
 	storageInterface := asyncstorageinterface.New(storage, *cfg.StorageInterfaceOpts)
-	storageInterface.Start(ctx, output)
+	storageInterface.Start(output)
 
-	queueManager := queuemanager.New(multiEncoder)
-	queueManager.Options = *cfg.QueueOpts
+	queueManager := queuemanager.New(multiEncoder, storage)
+	queueManager.Options = cfg.QueueOpts
 	queueManager.Workers["csv"] = multiEncoder.DecodeCSV
 	queueManager.Workers["json"] = multiEncoder.DecodeJSONBatch
-	queueManager.Start(ctx)
+	queueManager.Flush = storageInterface.Flush
+	analyzer.Uploads = queueManager
+	storageInterface.Uploads = queueManager
+	if err = queueManager.Start(ctx); err != nil {
+		log.Println(err.Error())
+	}
+
+	cacheManager := cachemanager.New(storage)
+	cacheManager.Options = cfg.CacheOpts
+	if err = cacheManager.Init(); err != nil {
+		log.Println(err.Error())
+	}
+	cacheManager.Start(ctx)
 
-	cacheManager := cachemanager.New()
+	proc := requestprocessor.New(storage, schemaManager, multiEncoder, analyzer)
 
-	proc := requestprocessor.New(storage, schemaManager, multiEncoder, analyzer, cacheManager)
+	pricing := pricing.New()
+	pricing.Options = cfg.PricingOpts
+	if err = pricing.Init(); err != nil {
+		log.Println(err.Error())
+	}
 
-	client := client.New(schemaManager, storage, queueManager, notificationManager, cacheManager)
+	scheduler := scheduler.New(storage)
+	scheduler.Options = cfg.SchedulerOpts
+
+	jobs := jobs.New(storage)
+	if err = jobs.Init(); err != nil {
+		log.Println(err.Error())
+	}
+
+	client := client.New(schemaManager, storage, queueManager, notificationManager, cacheManager, regions, pricing, scheduler, jobs)
 	client.Options = cfg.ClientOpts
-	client.Start(context.Background())
+	efind := efind.New()
+	efind.Options = cfg.EFindOpts
+	efind.Limiter = scheduler
+	client.Suppliers[efind.Name()] = efind
+	priceList := pricelist.New()
+	priceList.Options = cfg.PriceListOpts
+	if err = priceList.Start(ctx); err != nil {
+		log.Println(err.Error())
+	}
+	client.Suppliers[priceList.Name()] = priceList
+	schemaManager.Suppliers = []string{efind.Name(), priceList.Name()}
+	client.Start(ctx)
+	if err = scheduler.Start(ctx, client.Check, client.Report); err != nil {
+		log.Println(err.Error())
+	}
+
+	costing := costing.New(storage, schemaManager, pricing)
 
-	api := api.New(storage, proc, schemaManager, queueManager, userManager)
+	api := api.New(storage, proc, schemaManager, queueManager, userManager, regions, priceList, costing, scheduler, client, jobs, client)
 	api.Options = cfg.APIOpts
 	api.Init()
-	api.Run()
+	go func() {
+		if err := api.Run(); !errors.Is(err, http.ErrServerClosed) {
+			log.Println(err.Error())
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+	//every stage is drained after the ones that feed it, rows left in storage interface are appended to db last
+	shutdown, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err = api.Shutdown(shutdown); err != nil {
+		log.Println("api:", err.Error())
+	}
+	if err = queueManager.Shutdown(shutdown); err != nil {
+		log.Println("queue manager:", err.Error())
+	}
+	if err = scheduler.Shutdown(shutdown); err != nil {
+		log.Println("scheduler:", err.Error())
+	}
+	if err = jobs.Save(shutdown); err != nil {
+		log.Println("jobs:", err.Error())
+	}
+	if err = analyzer.Shutdown(shutdown); err != nil {
+		log.Println("analyzer:", err.Error())
+	}
+	if err = storageInterface.Shutdown(shutdown); err != nil {
+		log.Println("storage interface:", err.Error())
+	}
+	closed := make(chan struct{})
+	go func() {
+		storage.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		log.Println("stopped")
+	case <-shutdown.Done():
+		log.Println("stopped without closing database connections in time")
+	}
 }
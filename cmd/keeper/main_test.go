@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"os"
@@ -8,6 +9,8 @@ import (
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/icyrogue/ye-keeper/internal/usermanager"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,6 +31,22 @@ type testComponent struct {
 	Amount   string `json:"amount"`
 }
 
+// issueToken: login codes are sent by email, so tests get their tokens straight from user manager
+func issueToken(t *testing.T, email string) string {
+	pool, err := pgxpool.New(context.Background(), os.Getenv("KEEPER_DSN"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer pool.Close()
+	userManager := usermanager.New(pool)
+	userManager.Options = &usermanager.Options{SecretKey: os.Getenv("KEEPER_SECRET_KEY"), TokenTTL: time.Hour}
+	token, err := userManager.IssueToken(context.Background(), email)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return token
+}
+
 func Test_Register(t *testing.T) {
 	user := user{
 		email: "iwannagocollectleafs@bebe.bobo",
@@ -46,8 +65,15 @@ func Test_Register(t *testing.T) {
 			Post(addr + "/api/login")
 		assert.NoError(t, err)
 		assert.True(t, resp.IsSuccess(), string(resp.Body()))
-		assert.NotNil(t, resp.Body())
-		user.token = string(resp.Body())
+		assert.NotContains(t, string(resp.Body()), ".", "token shouldn't be sent in response")
+
+		resp, err = client.R().
+			SetBody(`{"email": "` + user.email + `", "code": "notacode"}`).
+			Post(addr + "/api/login/verify")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError(), "wrong login code shouldn't be accepted")
+
+		user.token = issueToken(t, user.email)
 	})
 
 	t.Run("Add and create", func(t *testing.T) {
@@ -76,6 +102,63 @@ func Test_Register(t *testing.T) {
 		user.cmpToDelete = body
 	})
 
+	t.Run("test members", func(t *testing.T) {
+		viewerEmail := "ijustwannalook@bebe.bobo"
+		viewerToken := issueToken(t, viewerEmail)
+
+		resp, err := client.R().SetHeader("Token", viewerToken).SetPathParam("id", user.id).Get(addr + "/api/list/{id}/schema")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError(), "user who isn't a member shouldn't see the list")
+
+		resp, err = client.R().SetBody(`{"email": "`+viewerEmail+`", "role": "viewer"}`).
+			SetHeader("Token", viewerToken).SetPathParam("id", user.id).Post(addr + "/api/list/{id}/invites")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError(), "only owner should be able to invite")
+
+		resp, err = client.R().SetBody(`{"email": "`+viewerEmail+`", "role": "viewer"}`).
+			SetHeader("Token", user.token).SetPathParam("id", user.id).Post(addr + "/api/list/{id}/invites")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", viewerToken).SetPathParam("code", "notarealcode").Post(addr + "/api/invites/{code}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError(), "invitation with wrong code shouldn't be accepted")
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).Get(addr + "/api/list/{id}/members")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+		assert.Contains(t, string(resp.Body()), user.email)
+		assert.NotContains(t, string(resp.Body()), viewerEmail)
+	})
+
+	t.Run("test API keys", func(t *testing.T) {
+		resp, err := client.R().SetBody(`{"name": "ci", "scopes": ["list:read"]}`).
+			SetHeader("Token", user.token).SetPathParam("id", user.id).Post(addr + "/api/list/{id}/keys")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+		var key struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Body(), &key))
+
+		resp, err = client.R().SetHeader("Token", key.Key).SetPathParam("id", user.id).Get(addr + "/api/list/{id}/schema")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetBody(user.cmpToDelete).SetHeader("Token", key.Key).SetPathParam("id", user.id).Put(addr + "/api/list/{id}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError(), "key without list:write scope shouldn't stop tracking components")
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("key", key.ID).Delete(addr + "/api/list/{id}/keys/{key}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", key.Key).SetPathParam("id", user.id).Get(addr + "/api/list/{id}/schema")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError(), "deleted key shouldn't be accepted")
+	})
+
 	t.Run("test Delete", func(t *testing.T) {
 		resp, err := client.R().EnableTrace().SetBody(user.cmpToDelete).SetHeader("Token", user.token).SetPathParam("id", user.id).Put(addr + "/api/list/{id}")
 		assert.NoError(t, err)
@@ -85,6 +168,79 @@ func Test_Register(t *testing.T) {
 
 	})
 
+	t.Run("test items", func(t *testing.T) {
+		resp, err := client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).
+			SetQueryParams(map[string]string{"pageNum": "1", "pageSize": "10", "all": "true"}).Get(addr + "/api/list/{id}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+		var list struct {
+			Components []struct {
+				Item      string            `json:"item"`
+				Component map[string]string `json:"component"`
+				Tracking  bool              `json:"tracking"`
+			} `json:"components"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Body(), &list))
+		if !assert.Len(t, list.Components, 1) {
+			return
+		}
+		item := list.Components[0]
+		assert.False(t, item.Tracking, "component should've stopped being tracked")
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("item", item.Item).
+			Post(addr + "/api/list/{id}/items/{item}/track")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetBody(`{"amount": "5"}`).SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("item", item.Item).
+			Patch(addr + "/api/list/{id}/items/{item}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).
+			SetQueryParams(map[string]string{"pageNum": "1", "pageSize": "10"}).Get(addr + "/api/list/{id}")
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(resp.Body(), &list))
+		if assert.Len(t, list.Components, 1, "editing an item shouldn't create a new one") {
+			assert.Equal(t, item.Item, list.Components[0].Item)
+			assert.Equal(t, "5", list.Components[0].Component["amount"])
+		}
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("item", item.Item).
+			Delete(addr + "/api/list/{id}/items/{item}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("item", item.Item).
+			Delete(addr + "/api/list/{id}/items/{item}")
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.StatusCode())
+	})
+
+	t.Run("test history", func(t *testing.T) {
+		resp, err := client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).
+			SetQueryParam("component", "TL072").Get(addr + "/api/list/{id}/history")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+		var history []struct {
+			Actor  string `json:"actor"`
+			Source string `json:"source"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Body(), &history))
+		sources := make(map[string]string)
+		for _, entry := range history {
+			sources[entry.Source] = entry.Actor
+		}
+		for _, source := range []string{"single", "untrack", "track", "edit", "delete"} {
+			assert.Equal(t, user.email, sources[source], "history should show who made %s change", source)
+		}
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).
+			SetQueryParam("from", "yesterday").Get(addr + "/api/list/{id}/history")
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode())
+	})
+
 	t.Run("test batch", func(t *testing.T) {
 		components := []testComponent{{Name: "CD4020", Position: "IC1", Amount: "2"},
 			{Name: "MPC2324", Position: "IC14", Amount: "2"},
@@ -93,11 +249,24 @@ func Test_Register(t *testing.T) {
 		if err != nil {
 			t.Fatal(err.Error())
 		}
-		resp, err := client.R().SetBody(body).SetHeader("Token", user.token).SetPathParam("id", user.id).Post(addr + "/api/list/{id}/batch")
+		var job struct {
+			Job    string `json:"job"`
+			Status string `json:"status"`
+			Rows   int    `json:"rows"`
+		}
+		resp, err := client.R().SetBody(body).SetHeader("Token", user.token).SetPathParam("id", user.id).SetResult(&job).
+			Post(addr + "/api/list/{id}/batch")
 		if err != nil {
 			t.Fatal(err.Error())
 		}
-		assert.True(t, resp.IsSuccess())
+		assert.Equal(t, 202, resp.StatusCode(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("jobId", job.Job).SetQueryParam("wait", "30s").
+			SetResult(&job).Get(addr + "/api/jobs/{jobId}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+		assert.Equal(t, "succeeded", job.Status)
+		assert.Equal(t, 3, job.Rows)
 		time.Sleep(50 * time.Second)
 	})
 
@@ -108,6 +277,57 @@ func Test_Register(t *testing.T) {
 		}
 		assert.True(t, resp.IsSuccess())
 		log.Println(string(resp.Body()))
+
+		resp, err = client.R().Get(addr + "/api/cache")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+	})
+
+	t.Run("test availability", func(t *testing.T) {
+		resp, err := client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("item", "CD4020").
+			Get(addr + "/api/list/{id}/items/{item}/history")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetPathParam("item", "NOTINLIST").
+			Get(addr + "/api/list/{id}/items/{item}/history")
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.StatusCode(), "history of components from other lists shouldn't be shown")
+	})
+
+	t.Run("test costing", func(t *testing.T) {
+		resp, err := client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetQueryParam("boards", "10").
+			Get(addr + "/api/list/{id}/costing")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetQueryParam("format", "csv").
+			Get(addr + "/api/list/{id}/costing")
+		assert.NoError(t, err)
+		assert.Equal(t, "text/csv", resp.Header().Get("Content-Type"))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetQueryParam("boards", "0").
+			Get(addr + "/api/list/{id}/costing")
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode())
+	})
+
+	t.Run("test check now", func(t *testing.T) {
+		var job struct {
+			Job string `json:"job"`
+		}
+		resp, err := client.R().SetHeader("Token", user.token).SetPathParam("id", user.id).SetResult(&job).
+			Post(addr + "/api/list/{id}/check")
+		assert.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode(), string(resp.Body()))
+
+		resp, err = client.R().SetHeader("Token", user.token).SetPathParam("jobId", job.Job).Get(addr + "/api/jobs/{jobId}")
+		assert.NoError(t, err)
+		assert.True(t, resp.IsSuccess(), string(resp.Body()))
+
+		resp, err = client.R().SetPathParam("jobId", job.Job).Get(addr + "/api/jobs/{jobId}")
+		assert.NoError(t, err)
+		assert.Equal(t, 401, resp.StatusCode())
 	})
 
 	t.Run("test csv", func(t *testing.T) {
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	_ "embed"
 	"encoding/json"
 	"errors"
 	"io"
@@ -12,33 +13,54 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/icyrogue/ye-keeper/internal/jobs"
+	"github.com/icyrogue/ye-keeper/internal/queuemanager"
 )
 
+// openAPI: description of every route registered in Init, has to be updated along with them
+//
+//go:embed openapi.json
+var openAPI []byte
+
 type api struct {
 	r             *gin.Engine
+	srv           *http.Server
+	stopping      context.Context
 	storage       Storage
 	processor     Processor
 	schemaManager SchemaManager
 	queueManager  QueueManager
 	userManager   UserManager
+	regions       Regions
+	priceLists    PriceLists
+	costing       Costing
+	scheduler     Scheduler
+	checker       Checker
+	jobs          Jobs
+	cache         Cache
 	Options       *Options
 }
 
 type Options struct {
-	Port string
+	Port       string
+	RetryAfter time.Duration
 }
 
 type Storage interface {
 	Ping(ctx context.Context) error
+	GetHistory(ctx context.Context, id, component string, from, to time.Time) ([]byte, error)
+	GetAvailability(ctx context.Context, id, item, region string, from, to time.Time) ([]byte, error)
 	//	GetList(ctx context.Context, id string) (map[string][]string, error)
 }
 
 type Processor interface {
 	GenList(ctx context.Context) (string, error)
-	AddItem(ctx context.Context, id string, data map[string]string) error
-	GetList(ctx context.Context, id string, pageNum, pageSize int) ([]byte, error)
-	HandleDelete(id string, data []byte) error
-	GetCached(ctx context.Context, name string) (data []byte, err error)
+	AddItem(ctx context.Context, id, actor string, data map[string]string) error
+	GetList(ctx context.Context, id string, pageNum, pageSize int, all bool) ([]byte, error)
+	HandleDelete(ctx context.Context, id, actor string, data []byte) error
+	EditItem(ctx context.Context, id, itemID, actor string, fields map[string]string) error
+	Track(ctx context.Context, id, itemID, actor string, tracking bool) error
+	DeleteItem(ctx context.Context, id, itemID, actor string) error
 }
 type SchemaManager interface {
 	GetSchemaJSON(id string) ([]byte, error)
@@ -46,48 +68,172 @@ type SchemaManager interface {
 }
 
 type QueueManager interface {
-	PushTask(id string, taskType string, body []byte, name string) error
+	PushTask(ctx context.Context, id, taskType, actor string, body []byte) (string, error)
+	Jobs
 }
 
 type UserManager interface {
-	Check(ctx context.Context, id, token string) error
+	Check(ctx context.Context, id, token, scope string) (string, error)
 	CheckWithEmail(ctx context.Context, tokenString string) (string, error)
-	NewUser(ctx context.Context, email string) (string, error)
+	CheckAdmin(ctx context.Context, tokenString string) (string, error)
+	RequestCode(ctx context.Context, email string) error
+	Login(ctx context.Context, email, code string) (string, error)
 	AddToUserLists(ctx context.Context, id, email string) error
 	GetUserIDs(ctx context.Context, email string) (ids []string, err error)
+	GetMembers(ctx context.Context, id string) ([]byte, error)
+	Invite(ctx context.Context, id, email, role string) error
+	AcceptInvite(ctx context.Context, code, email string) (string, error)
+	Revoke(ctx context.Context, id, email string) error
+	TransferOwnership(ctx context.Context, id, email string) error
+	SetNotify(ctx context.Context, id, email string, notify bool) error
+	RefreshToken(ctx context.Context, tokenString string) (string, error)
+	GetTokens(ctx context.Context, email string) ([]byte, error)
+	RevokeToken(ctx context.Context, email, jti string) error
+	RevokeTokens(ctx context.Context, email string) error
+	NewKey(ctx context.Context, id, email, name string, scopes []string) ([]byte, error)
+	GetKeys(ctx context.Context, id string) ([]byte, error)
+	DeleteKey(ctx context.Context, id, keyID string) error
+}
+
+type Regions interface {
+	GetJSON() ([]byte, error)
+}
+
+type PriceLists interface {
+	Save(name string, body []byte) error
+	GetJSON() ([]byte, error)
+}
+
+type Costing interface {
+	GetJSON(ctx context.Context, id string, boards int) ([]byte, error)
+	GetCSV(ctx context.Context, id string, boards int) ([]byte, error)
+}
+
+type Scheduler interface {
+	GetJSON() ([]byte, error)
+}
+
+type Checker interface {
+	CheckNow(ctx context.Context, id, item, actor string) (string, error)
+}
+
+type Jobs interface {
+	GetList(ctx context.Context, id string) (string, error)
+	GetJSON(ctx context.Context, id string, wait time.Duration) ([]byte, error)
+}
+
+type Cache interface {
+	GetCached(ctx context.Context, id, name string) ([]byte, error)
+	PurgeCache(ctx context.Context, id, item string) error
+	GetCacheJSON() ([]byte, error)
+}
+
+type invitation struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type loginCode struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
 }
 
-func New(st Storage, processor Processor, schemaManager SchemaManager, queueManager QueueManager, userManager UserManager) *api {
-	return &api{storage: st,
-		processor: processor, schemaManager: schemaManager, queueManager: queueManager, userManager: userManager}
+type keyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type notifications struct {
+	Notify bool `json:"notify"`
+}
+
+// Scopes of access to a list, same as in user manager
+const (
+	scopeListRead    = "list:read"
+	scopeListWrite   = "list:write"
+	scopeBOMWrite    = "bom:write"
+	scopeSchemaWrite = "schema:write"
+	scopeListAdmin   = "list:admin"
+)
+
+// roleViewer: role of invited users if none was given
+const roleViewer = "viewer"
+
+// maxJobWait: the longest time request for a job can wait for it to finish
+const maxJobWait = time.Minute
+
+func New(st Storage, processor Processor, schemaManager SchemaManager, queueManager QueueManager, userManager UserManager, regions Regions, priceLists PriceLists, costing Costing, scheduler Scheduler, checker Checker, jobs Jobs, cache Cache) *api {
+	return &api{storage: st, processor: processor, schemaManager: schemaManager, queueManager: queueManager,
+		userManager: userManager, regions: regions, priceLists: priceLists, costing: costing, scheduler: scheduler, checker: checker, jobs: jobs, cache: cache}
 }
 
 func (a *api) Init() {
 	a.r = gin.Default()
+	a.srv = &http.Server{Handler: a.r}
+	var stop context.CancelFunc
+	a.stopping, stop = context.WithCancel(context.Background())
+	a.srv.RegisterOnShutdown(stop)
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, "Token")
 	corsConfig.AllowAllOrigins = true
 	a.r.Use(cors.New(corsConfig))
 	keeper := a.r.Group("/api/list/")
-	//	keeper.Use(cors.Default(), a.authenticationMdw)
 	a.r.GET("/api/ping", a.ping)
 	a.r.GET("/api/pingdb", a.pingDb)
+	a.r.GET("/api/openapi.json", a.getOpenAPI)
+	a.r.GET("/api/regions", a.getRegions)
+	a.r.GET("/api/metrics", a.getMetrics)
+	a.r.GET("/api/cache", a.getCacheStats)
 	a.r.POST("/api/list/", a.newList)
-	keeper.POST("/:id", a.newItem)
-	keeper.GET("/:id/schema", a.getSchema)
-	keeper.POST("/:id/schema", a.saveSchema)
-	keeper.GET("/:id", a.getList)
-	keeper.POST("/:id/bom", a.postBOM)
-	keeper.POST("/:id/batch", a.postBatch)
-	keeper.GET("/:id/:name", a.getCached)
+	keeper.POST("/:id", a.authorize(scopeListWrite), a.newItem)
+	keeper.GET("/:id/schema", a.authorize(scopeListRead), a.getSchema)
+	keeper.POST("/:id/schema", a.authorize(scopeSchemaWrite), a.saveSchema)
+	keeper.GET("/:id", a.authorize(scopeListRead), a.getList)
+	keeper.POST("/:id/bom", a.authorize(scopeBOMWrite), a.postBOM)
+	keeper.POST("/:id/batch", a.authorize(scopeBOMWrite), a.postBatch)
+	keeper.GET("/:id/members", a.authorize(scopeListRead), a.getMembers)
+	keeper.DELETE("/:id/members/:email", a.authorize(scopeListRead), a.revokeMember)
+	keeper.POST("/:id/invites", a.authorize(scopeListAdmin), a.invite)
+	keeper.POST("/:id/owner", a.authorize(scopeListAdmin), a.transferOwnership)
+	keeper.PUT("/:id/notifications", a.authorize(scopeListRead), a.setNotify)
+	keeper.GET("/:id/history", a.authorize(scopeListRead), a.getHistory)
+	keeper.POST("/:id/check", a.authorize(scopeListWrite), a.checkNow)
+	keeper.DELETE("/:id/cache", a.authorize(scopeListWrite), a.purgeCache)
+	keeper.GET("/:id/costing", a.authorize(scopeListRead), a.getCosting)
+	keeper.GET("/:id/keys", a.authorize(scopeListAdmin), a.getKeys)
+	keeper.POST("/:id/keys", a.authorize(scopeListAdmin), a.newKey)
+	keeper.DELETE("/:id/keys/:keyId", a.authorize(scopeListAdmin), a.deleteKey)
+	keeper.GET("/:id/:name", a.authorize(scopeListRead), a.getCached)
 	a.r.GET("api/user/:email", a.getUserIDs)
-	keeper.PUT("/:id", a.deleteItem)
+	keeper.PUT("/:id", a.authorize(scopeListWrite), a.deleteItem)
+	keeper.PATCH("/:id/items/:itemId", a.authorize(scopeListWrite), a.editItem)
+	keeper.DELETE("/:id/items/:itemId", a.authorize(scopeListWrite), a.hardDeleteItem)
+	keeper.POST("/:id/items/:itemId/track", a.authorize(scopeListWrite), a.trackItem)
+	keeper.GET("/:id/items/:itemId/history", a.authorize(scopeListRead), a.getAvailability)
+	keeper.POST("/:id/items/:itemId/check", a.authorize(scopeListWrite), a.checkNow)
+	keeper.DELETE("/:id/items/:itemId/cache", a.authorize(scopeListWrite), a.purgeCache)
 	a.r.POST("/api/login", a.handleLogin)
+	a.r.POST("/api/login/verify", a.verifyLogin)
+	a.r.POST("/api/invites/:code", a.acceptInvite)
+	a.r.POST("/api/tokens/refresh", a.refreshToken)
+	a.r.GET("/api/tokens", a.getTokens)
+	a.r.DELETE("/api/tokens", a.revokeTokens)
+	a.r.DELETE("/api/tokens/:jti", a.revokeToken)
+	a.r.GET("/api/jobs/:jobId", a.getJob)
+	a.r.GET("/api/pricelists", a.getPriceLists)
+	a.r.POST("/api/pricelists/:name", a.savePriceList)
+
+}
 
+// Run: serves API until Shutdown, returns http.ErrServerClosed after it
+func (a *api) Run() error {
+	a.srv.Addr = ":" + a.Options.Port
+	return a.srv.ListenAndServe()
 }
 
-func (a *api) Run() {
-	log.Fatal(a.r.Run(":" + a.Options.Port))
+// Shutdown: stops accepting requests and waits for requests that are being handled, gives up when ctx is done
+func (a *api) Shutdown(ctx context.Context) error {
+	return a.srv.Shutdown(ctx)
 }
 
 // Ping: GET state of API
@@ -98,26 +244,109 @@ func (a *api) ping(c *gin.Context) {
 // Ping database: GET ping a database
 func (a *api) pingDb(c *gin.Context) {
 	if err := a.storage.Ping(c); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		fail(c, err)
 		return
 	}
 	c.String(http.StatusOK, "Hello from storage")
 }
 
+// getOpenAPI: GET OpenAPI document describing the API
+func (a *api) getOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPI)
+}
+
+// getRegions: GET region tree to choose region of a list from
+func (a *api) getRegions(c *gin.Context) {
+	body, err := a.regions.GetJSON()
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// getMetrics: GET EFind quota usage and lengths of scheduler queues
+func (a *api) getMetrics(c *gin.Context) {
+	body, err := a.scheduler.GetJSON()
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// getCacheStats: GET usage of cache of supplier offers, cache is shared by every list so only admins can see it
+func (a *api) getCacheStats(c *gin.Context) {
+	if _, err := a.userManager.CheckAdmin(c, c.GetHeader("Token")); err != nil {
+		fail(c, err)
+		return
+	}
+	body, err := a.cache.GetCacheJSON()
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// purgeCache: DELETE removes cached offers for tracked components of a list or one item so they are searched for again
+func (a *api) purgeCache(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := a.cache.PurgeCache(c, id, c.Param("itemId")); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// getPriceLists: GET names of price lists suppliers sent
+func (a *api) getPriceLists(c *gin.Context) {
+	if _, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token")); err != nil {
+		fail(c, err)
+		return
+	}
+	body, err := a.priceLists.GetJSON()
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// savePriceList: POST CSV or XLSX price list of a supplier, replaces price list with the same name.
+// Price lists are used by every list so only admins can change them
+func (a *api) savePriceList(c *gin.Context) {
+	if _, err := a.userManager.CheckAdmin(c, c.GetHeader("Token")); err != nil {
+		fail(c, err)
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	if err = a.priceLists.Save(c.Param("name"), body); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusCreated, "")
+}
+
 // New list: POST a new list
 func (a *api) newList(c *gin.Context) {
-	id, err := a.processor.GenList(c)
+	email, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
-	email, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
+	id, err := a.processor.GenList(c)
 	if err != nil {
-		c.String(http.StatusUnauthorized, err.Error())
+		fail(c, err)
 		return
 	}
 	if err = a.userManager.AddToUserLists(c, id, email); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
 	c.String(http.StatusCreated, "New list created with ID %s", id)
@@ -125,26 +354,26 @@ func (a *api) newList(c *gin.Context) {
 
 // Get list: get the list by id
 func (a *api) getList(c *gin.Context) {
-	id := c.Query("id")
+	id := c.Param("id")
 	pageNum := c.Query("pageNum")
 	pageSize := c.Query("pageSize")
 	pageNumInt, err := strconv.Atoi(pageNum)
 	if err != nil {
-		c.String(http.StatusBadRequest, "incorrect URL arguments ")
+		failWith(c, http.StatusBadRequest, codeInvalidInput, "incorrect URL arguments", gin.H{"pageNum": pageNum})
 		return
 	}
 	pageSizeInt, err := strconv.Atoi(pageSize)
 	if err != nil {
-		c.String(http.StatusBadRequest, "incorrect URL arguments ")
+		failWith(c, http.StatusBadRequest, codeInvalidInput, "incorrect URL arguments", gin.H{"pageSize": pageSize})
 		return
 	}
-	output, err := a.processor.GetList(c, id, pageNumInt, pageSizeInt)
+	output, err := a.processor.GetList(c, id, pageNumInt, pageSizeInt, c.Query("all") == "true")
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
 	c.Header("Content-Type", "application/json")
-	c.String(http.StatusFound, string(output))
+	c.String(http.StatusOK, string(output))
 }
 
 // New Item: POST a new item
@@ -155,16 +384,16 @@ func (a *api) newItem(c *gin.Context) {
 	defer c.Request.Body.Close()
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
 		return
 	}
 	if err = json.Unmarshal(body, &jsonMap); err != nil {
 		log.Println(string(body))
-		c.String(http.StatusBadRequest, err.Error())
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
 		return
 	}
-	if err = a.processor.AddItem(c, id, jsonMap); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	if err = a.processor.AddItem(c, id, c.GetString("email"), jsonMap); err != nil {
+		fail(c, err)
 		return
 	}
 	c.String(http.StatusCreated, "")
@@ -176,7 +405,7 @@ func (a *api) getSchema(c *gin.Context) {
 
 	body, err := a.schemaManager.GetSchemaJSON(id)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
 	c.Header("Content-Type", "application/json")
@@ -189,11 +418,11 @@ func (a *api) saveSchema(c *gin.Context) {
 	defer c.Request.Body.Close()
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
 		return
 	}
 	if err := a.schemaManager.SaveSchemaJSON(id, body); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
 	c.String(http.StatusOK, "")
@@ -203,88 +432,394 @@ func (a *api) saveSchema(c *gin.Context) {
 func (a *api) postBOM(c *gin.Context) {
 	id := c.Param("id")
 
-	if _, err := a.processor.GetList(c, id, 0, 0); err != nil {
-		c.String(http.StatusBadRequest, "no list with such ID")
+	if _, err := a.processor.GetList(c, id, 0, 0, false); err != nil {
+		fail(c, err)
 		return
 	}
 
 	if c.Request.Body == nil {
-		c.String(http.StatusBadRequest, errors.New("request has no body").Error())
+		failWith(c, http.StatusBadRequest, codeInvalidInput, "request has no body", nil)
 		return
 	}
+	a.pushUpload(c, id, "csv")
+}
+
+// postBatch: POST components as JSON array
+func (a *api) postBatch(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := a.processor.GetList(c, id, 0, 0, false); err != nil {
+		fail(c, err)
+		return
+	}
+	a.pushUpload(c, id, "json")
+}
+
+// pushUpload: queues request body as upload of list id in format and replies with its job,
+// client is asked to retry later when queue is full
+func (a *api) pushUpload(c *gin.Context, id, format string) {
 	body, err := c.GetRawData()
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
 		return
 	}
-	err = a.queueManager.PushTask(id, "csv", body, id+time.Now().Format(time.RFC3339))
+	job, err := a.queueManager.PushTask(c, id, format, c.GetString("email"), body)
+	if errors.Is(err, queuemanager.ErrBusy) {
+		c.Header("Retry-After", strconv.Itoa(int(a.Options.RetryAfter.Seconds())))
+	}
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
-	c.String(http.StatusAccepted, "")
+	c.Header("Location", "/api/jobs/"+job)
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
 }
 
-// postBatch: POST components as JSON array
-func (a *api) postBatch(c *gin.Context) {
+// deleteItem: PUT item out of the list of tracked ones
+func (a *api) deleteItem(c *gin.Context) {
 	id := c.Param("id")
 
 	body, err := c.GetRawData()
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
 		return
 	}
-	if err = a.queueManager.PushTask(id, "json", body, time.Now().Format(time.RFC3339)); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	if err := a.processor.HandleDelete(c, id, c.GetString("email"), body); err != nil {
+		fail(c, err)
 		return
 	}
-	c.String(http.StatusAccepted, "")
+	c.String(http.StatusOK, "")
+
 }
 
-// deleteItem: PUT item out of the list of tracked ones
-func (a *api) deleteItem(c *gin.Context) {
+// editItem: PATCH changes fields of an item component record
+func (a *api) editItem(c *gin.Context) {
 	id := c.Param("id")
 
-	body, err := c.GetRawData()
+	fields := make(map[string]string)
+	if err := c.ShouldBindJSON(&fields); err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	if err := a.processor.EditItem(c, id, c.Param("itemId"), c.GetString("email"), fields); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// hardDeleteItem: DELETE removes an item from a list for good
+func (a *api) hardDeleteItem(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := a.processor.DeleteItem(c, id, c.Param("itemId"), c.GetString("email")); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// trackItem: POST starts tracking an item again
+func (a *api) trackItem(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := a.processor.Track(c, id, c.Param("itemId"), c.GetString("email"), true); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// getHistory: GET changes of list items, can be filtered by component name and RFC3339 time range
+func (a *api) getHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	from, to, ok := timeRange(c)
+	if !ok {
+		return
+	}
+	body, err := a.storage.GetHistory(c, id, c.Query("component"), from, to)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// getAvailability: GET stock and prices of an item from every check, item is either its ID or component name,
+// can be filtered by region and RFC3339 time range
+func (a *api) getAvailability(c *gin.Context) {
+	id := c.Param("id")
+
+	from, to, ok := timeRange(c)
+	if !ok {
 		return
 	}
-	if err := a.processor.HandleDelete(id, body); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	body, err := a.storage.GetAvailability(c, id, c.Param("itemId"), c.Query("region"), from, to)
+	if err != nil {
+		fail(c, err)
 		return
 	}
-	c.String(http.StatusAccepted, "")
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// checkNow: POST checks tracked components of a list or one item right away, replies with ID of a job to follow
+func (a *api) checkNow(c *gin.Context) {
+	id := c.Param("id")
 
+	job, err := a.checker.CheckNow(c, id, c.Param("itemId"), c.GetString("email"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Location", "/api/jobs/"+job)
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
 }
 
-// authenticationMdw: middleware for dealing with API tokens
-func (a *api) authenticationMdw(c *gin.Context) {
-	listID := c.Param("id")
+// getJob: GET job with its progress, waits for job to finish for up to wait URL argument.
+// Token has to give access to a list job belongs to or be allowed to start such jobs
+func (a *api) getJob(c *gin.Context) {
+	jobID := c.Param("jobId")
 	token := c.GetHeader("Token")
 	if token == "" {
-		c.String(http.StatusUnauthorized, "no authentication token found in header Token")
-		c.AbortWithStatus(http.StatusUnauthorized)
+		failWith(c, http.StatusUnauthorized, codeUnauthorized, "no authentication token found in header Token", nil)
+		return
+	}
+	var wait time.Duration
+	if v := c.Query("wait"); v != "" {
+		var err error
+		if wait, err = time.ParseDuration(v); err != nil || wait < 0 {
+			failWith(c, http.StatusBadRequest, codeInvalidInput, "incorrect URL arguments", gin.H{"wait": v})
+			return
+		}
+		if wait > maxJobWait {
+			wait = maxJobWait
+		}
+	}
+	//job is either a check or an upload, scope is the one needed to start it
+	var source Jobs = a.jobs
+	scope := scopeListWrite
+	list, err := source.GetList(c, jobID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		source, scope = a.queueManager, scopeBOMWrite
+		list, err = source.GetList(c, jobID)
+	}
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if _, err = a.userManager.Check(c, list, token, scopeListRead); err != nil {
+		//keys that only upload BOMs follow their uploads without reading a list
+		if _, scopeErr := a.userManager.Check(c, list, token, scope); scopeErr != nil {
+			fail(c, err)
+			return
+		}
+	}
+	//waiting for a job ends once keeper stops, so it doesn't hold up shutdown
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.stopping.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	body, err := source.GetJSON(ctx, jobID, wait)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+// getCosting: GET cost of buying tracked components of a list for a number of boards as JSON
+// or as CSV if format is csv, build quantity of a list is used without boards
+func (a *api) getCosting(c *gin.Context) {
+	id := c.Param("id")
+
+	var boards int
+	if v := c.Query("boards"); v != "" {
+		var err error
+		if boards, err = strconv.Atoi(v); err != nil || boards < 1 {
+			failWith(c, http.StatusBadRequest, codeInvalidInput, "incorrect URL arguments", gin.H{"boards": v})
+			return
+		}
+	}
+	if c.Query("format") == "csv" {
+		body, err := a.costing.GetCSV(c, id, boards)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="costing.csv"`)
+		c.Data(http.StatusOK, "text/csv", body)
 		return
 	}
-	err := a.userManager.Check(c, listID, token)
+	body, err := a.costing.GetJSON(c, id, boards)
 	if err != nil {
-		c.String(http.StatusUnauthorized, err.Error())
-		err := c.AbortWithError(http.StatusUnauthorized, err)
-		log.Println(err.Error())
+		fail(c, err)
 		return
 	}
-	c.Next()
+	c.Data(http.StatusOK, "application/json", body)
 }
 
-// handleLogin: handles linking email to a token
+// timeRange: parses optional from and to URL arguments in RFC3339, replies with an error if they are incorrect
+func timeRange(c *gin.Context) (from, to time.Time, ok bool) {
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			failWith(c, http.StatusBadRequest, codeInvalidInput, "incorrect URL arguments", gin.H{"from": v})
+			return from, to, false
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			failWith(c, http.StatusBadRequest, codeInvalidInput, "incorrect URL arguments", gin.H{"to": v})
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+// authorize: returns middleware that lets through only requests with a token
+// of a list member or an API key allowed to access a list with given scope
+func (a *api) authorize(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listID := c.Param("id")
+		token := c.GetHeader("Token")
+		if token == "" {
+			failWith(c, http.StatusUnauthorized, codeUnauthorized, "no authentication token found in header Token", nil)
+			return
+		}
+		email, err := a.userManager.Check(c, listID, token, scope)
+		if err != nil {
+			log.Println(err.Error())
+			fail(c, err)
+			return
+		}
+		c.Set("email", email)
+		c.Next()
+	}
+}
+
+// getMembers: GET every member of a list with their roles
+func (a *api) getMembers(c *gin.Context) {
+	id := c.Param("id")
+
+	body, err := a.userManager.GetMembers(c, id)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Content-Type", "application/json")
+	c.String(http.StatusOK, string(body))
+}
+
+// invite: POST sends an invitation to a list to user email
+func (a *api) invite(c *gin.Context) {
+	id := c.Param("id")
+
+	var inv invitation
+	if err := c.ShouldBindJSON(&inv); err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	if inv.Role == "" {
+		inv.Role = roleViewer
+	}
+	if err := a.userManager.Invite(c, id, inv.Email, inv.Role); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusAccepted, "")
+}
+
+// acceptInvite: POST makes token owner a member of a list from invitation with code
+func (a *api) acceptInvite(c *gin.Context) {
+	email, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	id, err := a.userManager.AcceptInvite(c, c.Param("code"), email)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "Joined list with ID %s", id)
+}
+
+// revokeMember: DELETE removes a member from a list, only owner can remove others
+func (a *api) revokeMember(c *gin.Context) {
+	id := c.Param("id")
+	email := c.Param("email")
+
+	if email != c.GetString("email") {
+		if _, err := a.userManager.Check(c, id, c.GetHeader("Token"), scopeListAdmin); err != nil {
+			fail(c, err)
+			return
+		}
+	}
+	if err := a.userManager.Revoke(c, id, email); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// transferOwnership: POST makes another member an owner of a list
+func (a *api) transferOwnership(c *gin.Context) {
+	id := c.Param("id")
+
+	var newOwner invitation
+	if err := c.ShouldBindJSON(&newOwner); err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	if err := a.userManager.TransferOwnership(c, id, newOwner.Email); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// setNotify: PUT turns notifications about a list on or off for token owner
+func (a *api) setNotify(c *gin.Context) {
+	id := c.Param("id")
+
+	var n notifications
+	if err := c.ShouldBindJSON(&n); err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	if err := a.userManager.SetNotify(c, id, c.GetString("email"), n.Notify); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// handleLogin: sends one time login code to email from request body
 func (a *api) handleLogin(c *gin.Context) {
 	email, _ := c.GetRawData()
-	var token string
-	var err error
-	if token, err = a.userManager.NewUser(c, string(email)); err != nil {
-		log.Println(err.Error(), token)
-		c.String(http.StatusUnauthorized, err.Error()+token)
+	if err := a.userManager.RequestCode(c, string(email)); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusAccepted, "Login code was sent to %s", email)
+}
+
+// verifyLogin: exchanges login code for a token linked to email
+func (a *api) verifyLogin(c *gin.Context) {
+	var login loginCode
+	if err := c.ShouldBindJSON(&login); err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	token, err := a.userManager.Login(c, login.Email, login.Code)
+	if err != nil {
+		fail(c, err)
 		return
 	}
 	c.String(http.StatusOK, token)
@@ -294,8 +829,8 @@ func (a *api) getCached(c *gin.Context) {
 	name := c.Param("name")
 	var data []byte
 	var err error
-	if data, err = a.processor.GetCached(c, name); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	if data, err = a.cache.GetCached(c, c.Param("id"), name); err != nil {
+		fail(c, err)
 		return
 	}
 	c.String(http.StatusOK, string(data))
@@ -303,10 +838,115 @@ func (a *api) getCached(c *gin.Context) {
 
 func (a *api) getUserIDs(c *gin.Context) {
 	email := c.Param("email")
+	tokenEmail, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if tokenEmail != email {
+		failWith(c, http.StatusForbidden, codeForbidden, "token doesn't belong to user "+email, nil)
+		return
+	}
 	ids, err := a.userManager.GetUserIDs(c, email)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		fail(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, ids)
 }
+
+// refreshToken: POST exchanges valid token for a new one, old token is revoked
+func (a *api) refreshToken(c *gin.Context) {
+	token, err := a.userManager.RefreshToken(c, c.GetHeader("Token"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// getTokens: GET every active token of token owner
+func (a *api) getTokens(c *gin.Context) {
+	email, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	body, err := a.userManager.GetTokens(c, email)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Content-Type", "application/json")
+	c.String(http.StatusOK, string(body))
+}
+
+// revokeToken: DELETE revokes one of token owner tokens by its ID
+func (a *api) revokeToken(c *gin.Context) {
+	email, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if err = a.userManager.RevokeToken(c, email, c.Param("jti")); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// revokeTokens: DELETE revokes every token of token owner including the one used for request
+func (a *api) revokeTokens(c *gin.Context) {
+	email, err := a.userManager.CheckWithEmail(c, c.GetHeader("Token"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if err = a.userManager.RevokeTokens(c, email); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
+
+// newKey: POST creates API key with scopes for a list, key is returned only once
+func (a *api) newKey(c *gin.Context) {
+	id := c.Param("id")
+
+	var req keyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		failWith(c, http.StatusBadRequest, codeInvalidInput, err.Error(), nil)
+		return
+	}
+	body, err := a.userManager.NewKey(c, id, c.GetString("email"), req.Name, req.Scopes)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Content-Type", "application/json")
+	c.String(http.StatusCreated, string(body))
+}
+
+// getKeys: GET every API key of a list
+func (a *api) getKeys(c *gin.Context) {
+	id := c.Param("id")
+
+	body, err := a.userManager.GetKeys(c, id)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Content-Type", "application/json")
+	c.String(http.StatusOK, string(body))
+}
+
+// deleteKey: DELETE revokes API key of a list
+func (a *api) deleteKey(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := a.userManager.DeleteKey(c, id, c.Param("keyId")); err != nil {
+		fail(c, err)
+		return
+	}
+	c.String(http.StatusOK, "")
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icyrogue/ye-keeper/internal/jobs"
+	"github.com/icyrogue/ye-keeper/internal/usermanager"
+	"github.com/stretchr/testify/assert"
+)
+
+// testUserManager: user manager that only implements methods tests need, the rest panic
+type testUserManager struct {
+	UserManager
+	requestCode func(email string) error
+	admins      map[string]bool
+	scopes      map[string][]string
+}
+
+func (u *testUserManager) Check(ctx context.Context, id, token, scope string) (string, error) {
+	for _, s := range u.scopes[token] {
+		if s == scope {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("%w: key has no scope %s", usermanager.ErrForbidden, scope)
+}
+
+func (u *testUserManager) CheckAdmin(ctx context.Context, token string) (string, error) {
+	if !u.admins[token] {
+		return "", fmt.Errorf("%w: %s isn't an admin of keeper", usermanager.ErrForbidden, token)
+	}
+	return token, nil
+}
+
+type testPriceLists struct {
+	saved map[string][]byte
+}
+
+func (p *testPriceLists) Save(name string, body []byte) error {
+	p.saved[name] = body
+	return nil
+}
+
+func (p *testPriceLists) GetJSON() ([]byte, error) {
+	return []byte("[]"), nil
+}
+
+// testJobs: jobs of list "list" by their IDs
+type testJobs map[string]bool
+
+func (j testJobs) GetList(ctx context.Context, id string) (string, error) {
+	if !j[id] {
+		return "", jobs.ErrNotFound
+	}
+	return "list", nil
+}
+
+func (j testJobs) GetJSON(ctx context.Context, id string, wait time.Duration) ([]byte, error) {
+	return []byte(`{"status": "succeeded"}`), nil
+}
+
+// testCache: cache that only reports its usage
+type testCache struct {
+	Cache
+}
+
+func (testCache) GetCacheJSON() ([]byte, error) {
+	return []byte(`{"hits": 1}`), nil
+}
+
+type testQueueManager struct {
+	testJobs
+}
+
+func (q testQueueManager) PushTask(ctx context.Context, id, taskType, actor string, body []byte) (string, error) {
+	return "", nil
+}
+
+func (u *testUserManager) RequestCode(ctx context.Context, email string) error {
+	return u.requestCode(email)
+}
+
+func newTestAPI(userManager UserManager, priceLists PriceLists) *api {
+	gin.SetMode(gin.TestMode)
+	a := New(nil, nil, nil, nil, userManager, nil, priceLists, nil, nil, nil, nil, nil)
+	a.Options = &Options{}
+	a.Init()
+	return a
+}
+
+func Test_Login(t *testing.T) {
+	a := newTestAPI(&testUserManager{requestCode: func(email string) error {
+		switch email {
+		case "limited@example.com":
+			return fmt.Errorf("%w: too many login codes requested for %s, try again later", usermanager.ErrTooManyRequests, email)
+		case "invalid":
+			return fmt.Errorf("%w: mail: missing '@' or angle-addr", usermanager.ErrInvalidInput)
+		case "down@example.com":
+			return fmt.Errorf("dial tcp: connection refused")
+		}
+		return nil
+	}}, nil)
+
+	for email, status := range map[string]int{
+		"someone@example.com": http.StatusAccepted,
+		"limited@example.com": http.StatusTooManyRequests,
+		"invalid":             http.StatusBadRequest,
+		"down@example.com":    http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(email)))
+		assert.Equal(t, status, w.Code, email)
+		if status == http.StatusInternalServerError {
+			assert.NotContains(t, w.Body.String(), "connection refused", "internal errors shouldn't be shown to clients")
+		}
+	}
+}
+
+func Test_SavePriceList(t *testing.T) {
+	priceLists := &testPriceLists{saved: map[string][]byte{}}
+	a := newTestAPI(&testUserManager{admins: map[string]bool{"admin@example.com": true}}, priceLists)
+
+	for token, status := range map[string]int{
+		"member@example.com": http.StatusForbidden,
+		"admin@example.com":  http.StatusCreated,
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/pricelists/chipdip", strings.NewReader("part,stock\nTL072,10"))
+		req.Header.Set("Token", token)
+		a.r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, token)
+	}
+	assert.Len(t, priceLists.saved, 1, "price list of a member shouldn't be saved")
+}
+
+func Test_GetJob(t *testing.T) {
+	a := newTestAPI(&testUserManager{scopes: map[string][]string{
+		"reader":   {"list:read"},
+		"uploader": {"bom:write"},
+		"checker":  {"list:write"},
+	}}, nil)
+	a.jobs = testJobs{"check": true}
+	a.queueManager = testQueueManager{testJobs{"upload": true}}
+
+	for _, tc := range []struct {
+		job, token string
+		status     int
+	}{
+		{"upload", "reader", http.StatusOK},
+		{"upload", "uploader", http.StatusOK},
+		{"upload", "checker", http.StatusForbidden},
+		{"check", "checker", http.StatusOK},
+		{"check", "uploader", http.StatusForbidden},
+		{"missing", "reader", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+tc.job, nil)
+		req.Header.Set("Token", tc.token)
+		a.r.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, tc.job+" "+tc.token)
+	}
+}
+
+func Test_GetCacheStats(t *testing.T) {
+	a := newTestAPI(&testUserManager{admins: map[string]bool{"admin@example.com": true}}, nil)
+	a.cache = testCache{}
+
+	for token, status := range map[string]int{
+		"member@example.com": http.StatusForbidden,
+		"admin@example.com":  http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/cache", nil)
+		req.Header.Set("Token", token)
+		a.r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, token)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icyrogue/ye-keeper/internal/client"
+	"github.com/icyrogue/ye-keeper/internal/dbstorage"
+	"github.com/icyrogue/ye-keeper/internal/jobs"
+	"github.com/icyrogue/ye-keeper/internal/pricelist"
+	"github.com/icyrogue/ye-keeper/internal/queuemanager"
+	"github.com/icyrogue/ye-keeper/internal/requestprocessor"
+	"github.com/icyrogue/ye-keeper/internal/schemamanager"
+	"github.com/icyrogue/ye-keeper/internal/usermanager"
+)
+
+// errorVersion: version of error responses format, sent in header Keeper-Error-Version
+// so clients can tell it apart from plain text errors of older versions
+const errorVersion = "1"
+
+// Error codes, clients should rely on them instead of messages
+const (
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeNotFound        = "not_found"
+	codeInvalidInput    = "invalid_input"
+	codeConflict        = "conflict"
+	codeTooManyRequests = "too_many_requests"
+	codeNotCached       = "not_cached"
+	codeInternal        = "internal"
+)
+
+type apiError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings: sentinel errors of other packages with their status and code
+var errorMappings = []errorMapping{
+	{usermanager.ErrUnauthorized, http.StatusUnauthorized, codeUnauthorized},
+	{usermanager.ErrForbidden, http.StatusForbidden, codeForbidden},
+	{usermanager.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{usermanager.ErrInvalidInput, http.StatusBadRequest, codeInvalidInput},
+	{usermanager.ErrTooManyRequests, http.StatusTooManyRequests, codeTooManyRequests},
+	{schemamanager.ErrNoSchema, http.StatusNotFound, codeNotFound},
+	{schemamanager.ErrSchemaExists, http.StatusConflict, codeConflict},
+	{schemamanager.ErrNoNameField, http.StatusBadRequest, codeInvalidInput},
+	{schemamanager.ErrInvalidSchema, http.StatusBadRequest, codeInvalidInput},
+	{dbstorage.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{dbstorage.ErrConflict, http.StatusConflict, codeConflict},
+	{requestprocessor.ErrInvalidComponent, http.StatusBadRequest, codeInvalidInput},
+	{client.ErrNotCached, http.StatusNotFound, codeNotCached},
+	{pricelist.ErrInvalidFile, http.StatusBadRequest, codeInvalidInput},
+	{pricelist.ErrInvalidName, http.StatusBadRequest, codeInvalidInput},
+	{jobs.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{queuemanager.ErrUnknownFormat, http.StatusBadRequest, codeInvalidInput},
+	{queuemanager.ErrBusy, http.StatusTooManyRequests, codeTooManyRequests},
+}
+
+// fail: replies with JSON error, status and code depend on sentinel error err wraps,
+// unknown errors are internal ones and their messages aren't shown to clients
+func fail(c *gin.Context, err error) {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			failWith(c, m.status, m.code, err.Error(), nil)
+			return
+		}
+	}
+	log.Println(err.Error())
+	failWith(c, http.StatusInternalServerError, codeInternal, "internal server error", nil)
+}
+
+// failWith: replies with JSON error with given status and code, aborts handlers chain
+func failWith(c *gin.Context, status int, code, message string, details interface{}) {
+	c.Header("Keeper-Error-Version", errorVersion)
+	c.AbortWithStatusJSON(status, apiError{Code: code, Message: message, Details: details})
+}
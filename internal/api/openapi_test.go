@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_OpenAPI: every registered route should be described in OpenAPI document and vice versa
+func Test_OpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openAPI, &doc))
+
+	a := New(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	a.Init()
+	registered := make(map[string]bool)
+	for _, route := range a.r.Routes() {
+		var segments []string
+		for _, segment := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				segment = "{" + segment[1:] + "}"
+			}
+			segments = append(segments, segment)
+		}
+		path := strings.Join(segments, "/")
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+		_, fd := doc.Paths[path][method]
+		assert.True(t, fd, "route %s %s isn't described in openapi.json", route.Method, path)
+	}
+	for path, methods := range doc.Paths {
+		for method := range methods {
+			assert.True(t, registered[method+" "+path], "openapi.json describes %s %s which isn't registered", method, path)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package asyncstorageinterface
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 )
@@ -12,6 +13,16 @@ type storageInterface struct {
 	data [][]interface{}
 	storage Storage
 	options *Options
+	stop chan context.Context
+	stopped chan struct{}
+	flush chan struct{}
+	Uploads Uploads
+}
+
+//Uploads: gets result of saving every item that came with an upload, upload ID goes after columns and
+//who made the change and how
+type Uploads interface {
+	Stored(upload string, err error)
 }
 
 type Options struct {
@@ -27,41 +38,114 @@ func New(storage Storage, options Options) *storageInterface {
 	return &storageInterface{storage: storage,
 		options: &options,
 		data: [][]interface{}{},
+		stop: make(chan context.Context),
+		stopped: make(chan struct{}),
+		flush: make(chan struct{}, 1),
 		}
 }
 
-//Starts storage interface with input from analyzer
-func (si *storageInterface) Start(ctx context.Context, input chan []interface{}) {
-	go func (){
-	log.Println("started storage interface")
-		timer := time.AfterFunc(time.Duration(si.options.MaxWaitTime)*time.Second, si.appendToDB)
+//Starts storage interface with input from analyzer, items are appended to db once there are
+//more than MaxBufferLength of them or no item came for MaxWaitTime seconds
+func (si *storageInterface) Start(input chan []interface{}) {
+	go func() {
+		log.Println("started storage interface")
+		defer close(si.stopped)
+		wait := time.Duration(si.options.MaxWaitTime) * time.Second
+		timer := time.NewTimer(wait)
 		defer timer.Stop()
-		loop:
-	for {
-		select {
-		case <- ctx.Done():
-			break loop
-		case v := <- input:
-			log.Printf("storage got %s, %s, %s", v[0], v[1], v[2])
-			timer.Reset(time.Duration(si.options.MaxWaitTime)*time.Second)
-			si.data = append(si.data, v)
-			if len(si.data) > si.options.MaxBufferLength {
-				si.appendToDB()
+		for {
+			select {
+			case ctx := <-si.stop:
+				//items sent before Shutdown are appended too
+			drain:
+				for {
+					select {
+					case v := <-input:
+						si.data = append(si.data, v)
+					default:
+						break drain
+					}
+				}
+				si.appendToDB(ctx)
+				return
+			case <-timer.C:
+				si.appendToDB(context.Background())
+				timer.Reset(wait)
+			case <-si.flush:
+				si.appendToDB(context.Background())
+			case v := <-input:
+				log.Printf("storage got %s, %s, %s", v[0], v[1], v[2])
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(wait)
+				si.data = append(si.data, v)
+				if len(si.data) > si.options.MaxBufferLength {
+					si.appendToDB(context.Background())
+				}
 			}
 		}
-	}
-		timer.Stop()
 	}()
 }
 
-//appendToDB: appends every item from storage interface to db
-func (si *storageInterface) appendToDB() {
+//Shutdown: appends items that are left to db, gives up when ctx is done
+func (si *storageInterface) Shutdown(ctx context.Context) error {
+	select {
+	case si.stop <- ctx:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-si.stopped:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//Flush: asks storage interface to append items it holds to db right away
+func (si *storageInterface) Flush() {
+	select {
+	case si.flush <- struct{}{}:
+	default:
+	}
+}
+
+//appendToDB: appends every item from storage interface to db, if that fails items are appended one by one
+//so one broken item doesn't take the rest with it. Result of every item is reported to its upload
+func (si *storageInterface) appendToDB(ctx context.Context) {
 	if len(si.data) == 0 {
 		return
 	}
-	if err := si.storage.AddItem(context.Background(), si.data); err != nil {
+	err := si.storage.AddItem(ctx, si.data)
+	if err == nil {
+		for _, item := range si.data {
+			si.report(item, nil)
+		}
+	} else {
 		log.Println(err.Error())
+		for _, item := range si.data {
+			err := si.storage.AddItem(ctx, [][]interface{}{item})
+			if err != nil {
+				err = fmt.Errorf("%v: %w", item[1], err)
+				log.Println(err.Error())
+			}
+			si.report(item, err)
+		}
 	}
 	si.data = [][]interface{}{}
 	log.Println("appended to db")
 }
+
+//report: passes result of saving item to its upload if it came with one
+func (si *storageInterface) report(item []interface{}, err error) {
+	if si.Uploads == nil || len(item) < 7 {
+		return
+	}
+	if upload, ok := item[6].(string); ok {
+		si.Uploads.Stored(upload, err)
+	}
+}
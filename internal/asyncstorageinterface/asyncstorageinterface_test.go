@@ -0,0 +1,76 @@
+package asyncstorageinterface
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStorage struct {
+	mtx   sync.Mutex
+	items [][]interface{}
+}
+
+func (st *testStorage) AddItem(ctx context.Context, args [][]interface{}) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	for _, arg := range args {
+		if arg[1] == "broken" {
+			return errors.New("invalid input syntax for type json")
+		}
+	}
+	st.items = append(st.items, args...)
+	return nil
+}
+
+type testUploads struct {
+	mtx    sync.Mutex
+	stored map[string]int
+	errors []string
+}
+
+func (u *testUploads) Stored(upload string, err error) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	if err != nil {
+		u.errors = append(u.errors, err.Error())
+		return
+	}
+	u.stored[upload]++
+}
+
+func Test_Shutdown(t *testing.T) {
+	storage := &testStorage{}
+	si := New(storage, Options{MaxWaitTime: 60, MaxBufferLength: 10})
+	input := make(chan []interface{}, 5)
+	si.Start(input)
+	input <- []interface{}{"list", "TL072", []byte("{}")}
+	input <- []interface{}{"list", "NE555", []byte("{}")}
+
+	require.NoError(t, si.Shutdown(context.Background()))
+	storage.mtx.Lock()
+	defer storage.mtx.Unlock()
+	assert.Len(t, storage.items, 2, "buffered items should be appended on shutdown")
+}
+
+func Test_Report(t *testing.T) {
+	storage := &testStorage{}
+	uploads := &testUploads{stored: map[string]int{}}
+	si := New(storage, Options{MaxWaitTime: 60, MaxBufferLength: 10})
+	si.Uploads = uploads
+	input := make(chan []interface{})
+	si.Start(input)
+	input <- []interface{}{"list", "TL072", []byte("{}"), true, "someone@example.com", "bom", "upload"}
+	input <- []interface{}{"list", "broken", []byte("{"), true, "someone@example.com", "bom", "upload"}
+	input <- []interface{}{"list", "NE555", []byte("{}"), false, "someone@example.com", "untrack"}
+	si.Flush()
+
+	require.NoError(t, si.Shutdown(context.Background()))
+	assert.Len(t, storage.items, 2, "the rest of items should be saved when one of them is broken")
+	assert.Equal(t, map[string]int{"upload": 1}, uploads.stored)
+	assert.Equal(t, []string{"broken: invalid input syntax for type json"}, uploads.errors)
+}
@@ -1,87 +1,344 @@
 package cachemanager
 
 import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
-	"github.com/zpatrick/go-cache"
-	"golang.org/x/net/context"
 )
 
 type response = jsonmodels.JSONResponse
 
+// cacheManager: offers of suppliers by region and query, the most recently used entries are kept in memory
+// and every entry is saved to storage so that restart doesn't make every component to be searched for again
 type cacheManager struct {
-	queue map[string]bool
-	cache *cache.Cache
-	mtx   sync.RWMutex
+	mtx     sync.Mutex
+	entries map[key]*list.Element
+	lru     *list.List
+	pending map[key]*pending
+	ttls    map[string]time.Duration
+	stats   stats
+	storage Storage
+	Options *Options
 }
 
-func New() *cacheManager {
-	return &cacheManager{
-		queue: make(map[string]bool),
-		cache: cache.New(),
-	}
+type Options struct {
+	MaxEntries int
+	TTL        time.Duration
+	TTLs       string
+	MaxWait    time.Duration
 }
 
-func (c *cacheManager) Check(name string) bool {
-	c.mtx.RLock()
+// Storage: keeps cached offers between restarts
+type Storage interface {
+	SaveCache(ctx context.Context, supplier, region, query string, data []byte, stored, expires time.Time) error
+	GetCache(ctx context.Context, supplier, region, query string) ([]byte, time.Time, time.Time, error)
+	DeleteCache(ctx context.Context, supplier, region, query string) error
+	DeleteExpiredCache(ctx context.Context) error
+}
 
-	//If value is in cache, return true
-	if c.queue[name] {
-		c.mtx.RUnlock()
-		return true
-	}
-	c.mtx.RUnlock()
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+type key struct {
+	supplier string
+	region   string
+	query    string
+}
 
-	//if value hasnt yet been cached, return false but set
-	//queue value to true for other requests with the same name
-	c.queue[name] = true
-	return false
+type entry struct {
+	key     key
+	data    []response
+	stored  time.Time
+	expires time.Time
+}
+
+// stats: cache usage since start, hits include offers read from storage and offers received after waiting
+type stats struct {
+	Entries    int                  `json:"entries"`
+	MaxEntries int                  `json:"maxEntries"`
+	Searching  int                  `json:"searching"`
+	Hits       int                  `json:"hits"`
+	Misses     int                  `json:"misses"`
+	Waited     int                  `json:"waited"`
+	Stale      int                  `json:"stale"`
+	Loaded     int                  `json:"loaded"`
+	Evicted    int                  `json:"evicted"`
+	Expired    int                  `json:"expired"`
+	Purged     int                  `json:"purged"`
+	Suppliers  map[string]*counters `json:"suppliers"`
+}
+
+// counters: hits and misses of a supplier
+type counters struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
 }
 
-func (c *cacheManager) Store(name string, data []response) {
-	c.cache.Set(name, data)
-	c.mtx.RLock()
-	if c.queue[name] {
-		c.mtx.RUnlock()
-		return
+// pending: search for offers that is in progress, done is closed once it is stored or released
+type pending struct {
+	started time.Time
+	done    chan struct{}
+}
+
+// cleanupInterval: how often expired entries are deleted from storage
+const cleanupInterval = time.Hour
+
+func New(storage Storage) *cacheManager {
+	return &cacheManager{entries: make(map[key]*list.Element), lru: list.New(), pending: make(map[key]*pending),
+		ttls: make(map[string]time.Duration), stats: stats{Suppliers: make(map[string]*counters)}, storage: storage}
+}
+
+// Init: parses TTLs of suppliers and regions, such as efind=6h,efind/77=1h,*/78=2h,pricelist=10m.
+// Rule for supplier in region is used first, then rule for supplier, then rule for region and then default TTL
+func (c *cacheManager) Init() error {
+	for _, rule := range strings.Split(c.Options.TTLs, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		scope, value, fd := strings.Cut(rule, "=")
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if !fd || err != nil || ttl <= 0 {
+			return fmt.Errorf("incorrect cache TTL %s, should look like supplier/region=1h", rule)
+		}
+		c.ttls[strings.TrimSpace(scope)] = ttl
 	}
-	c.mtx.RUnlock()
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-	c.queue[name] = true
+	return nil
 }
 
-func (c *cacheManager) Get(ctx context.Context, name string) chan []response {
-	output := make(chan []response)
-	c.mtx.RLock()
-	ticker := time.NewTicker(time.Second * 2)
-	var timeout int
+// Start: deletes expired entries from storage every hour until ctx is done
+func (c *cacheManager) Start(ctx context.Context) {
 	go func() {
-	loop:
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
 		for {
+			if err := c.storage.DeleteExpiredCache(ctx); err != nil {
+				log.Println(err.Error())
+			}
 			select {
 			case <-ctx.Done():
-				break loop
+				return
 			case <-ticker.C:
-				v, ok := c.cache.GetOK(name)
-				if ok {
-					output <- v.([]response) //TODO: add custom type
-					break loop
-				}
-				timeout++
-				if timeout >= 10 {
-					c.mtx.Lock()
-					defer c.mtx.Unlock()
-					c.queue[name] = false
-					break loop
-				}
 			}
 		}
-		close(output)
 	}()
-	return output
+}
+
+// Check: reports whether offers of supplier for query in region are cached or somebody is already searching for them.
+// Offers older than maxAge aren't used unless it is zero. Otherwise caller is expected to search for offers
+// and either Store them or Release query
+func (c *cacheManager) Check(supplier, region, query string, maxAge time.Duration) bool {
+	k := key{supplier: supplier, region: region, query: query}
+	c.mtx.Lock()
+	if c.get(k, maxAge) != nil || c.searching(k) {
+		c.count(supplier, true)
+		c.mtx.Unlock()
+		return true
+	}
+	c.mtx.Unlock()
+
+	//entry may be only in storage after restart or after it was evicted
+	loaded := c.load(k, maxAge)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if loaded || c.searching(k) {
+		c.count(supplier, true)
+		return true
+	}
+	c.count(supplier, false)
+	c.pending[k] = &pending{started: time.Now(), done: make(chan struct{})}
+	return false
+}
+
+// Store: caches offers of supplier for query in region and wakes everyone waiting for them
+func (c *cacheManager) Store(supplier, region, query string, data []response) {
+	k := key{supplier: supplier, region: region, query: query}
+	stored := time.Now()
+	expires := stored.Add(c.ttl(supplier, region))
+	c.mtx.Lock()
+	c.add(&entry{key: k, data: data, stored: stored, expires: expires})
+	c.release(k)
+	c.mtx.Unlock()
+
+	body, err := json.Marshal(data)
+	if err == nil {
+		err = c.storage.SaveCache(context.Background(), supplier, region, query, body, stored, expires)
+	}
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// Release: tells those waiting for offers of supplier for query in region that search for them failed
+func (c *cacheManager) Release(supplier, region, query string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.release(key{supplier: supplier, region: region, query: query})
+}
+
+// Get: returns cached offers of supplier for query in region, waits for them if somebody is searching for them.
+// Offers older than maxAge aren't used unless it is zero. Reports false if offers aren't cached and nobody stored them in time
+func (c *cacheManager) Get(ctx context.Context, supplier, region, query string, maxAge time.Duration) ([]response, bool) {
+	k := key{supplier: supplier, region: region, query: query}
+	c.mtx.Lock()
+	if e := c.get(k, maxAge); e != nil {
+		c.mtx.Unlock()
+		return e.data, true
+	}
+	p, fd := c.pending[k]
+	c.mtx.Unlock()
+
+	if fd {
+		timer := time.NewTimer(c.Options.MaxWait - time.Since(p.started))
+		select {
+		case <-p.done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	} else if !c.load(k, maxAge) {
+		return nil, false
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e := c.get(k, maxAge); e != nil {
+		if fd {
+			c.stats.Waited++
+		}
+		return e.data, true
+	}
+	return nil, false
+}
+
+// Purge: removes cached offers of supplier for query in region
+func (c *cacheManager) Purge(ctx context.Context, supplier, region, query string) error {
+	k := key{supplier: supplier, region: region, query: query}
+	c.mtx.Lock()
+	if el, fd := c.entries[k]; fd {
+		c.lru.Remove(el)
+		delete(c.entries, k)
+		c.stats.Purged++
+	}
+	c.mtx.Unlock()
+	return c.storage.DeleteCache(ctx, supplier, region, query)
+}
+
+// GetJSON: returns cache stats as JSON
+func (c *cacheManager) GetJSON() ([]byte, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.stats.Entries = c.lru.Len()
+	c.stats.MaxEntries = c.Options.MaxEntries
+	c.stats.Searching = len(c.pending)
+	return json.Marshal(&c.stats)
+}
+
+// get: returns entry and marks it as recently used, expired entry is removed and entry older
+// than maxAge is left for other lists. Caller holds the lock
+func (c *cacheManager) get(k key, maxAge time.Duration) *entry {
+	el, fd := c.entries[k]
+	if !fd {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, k)
+		c.stats.Expired++
+		return nil
+	}
+	if maxAge > 0 && time.Since(e.stored) > maxAge {
+		c.stats.Stale++
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e
+}
+
+// add: puts entry in memory, the least recently used entries are evicted over limit. Caller holds the lock
+func (c *cacheManager) add(e *entry) {
+	if el, fd := c.entries[e.key]; fd {
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[e.key] = c.lru.PushFront(e)
+	}
+	for c.Options.MaxEntries > 0 && c.lru.Len() > c.Options.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+		c.stats.Evicted++
+	}
+}
+
+// count: counts hit or miss of supplier. Caller holds the lock
+func (c *cacheManager) count(supplier string, hit bool) {
+	sc, fd := c.stats.Suppliers[supplier]
+	if !fd {
+		sc = &counters{}
+		c.stats.Suppliers[supplier] = sc
+	}
+	if hit {
+		c.stats.Hits++
+		sc.Hits++
+	} else {
+		c.stats.Misses++
+		sc.Misses++
+	}
+}
+
+// searching: reports whether somebody is searching for offers, search that takes longer
+// than max wait is considered lost. Caller holds the lock
+func (c *cacheManager) searching(k key) bool {
+	p, fd := c.pending[k]
+	if fd && time.Since(p.started) >= c.Options.MaxWait {
+		c.release(k)
+		return false
+	}
+	return fd
+}
+
+// release: removes search in progress and wakes everyone waiting for it. Caller holds the lock
+func (c *cacheManager) release(k key) {
+	if p, fd := c.pending[k]; fd {
+		close(p.done)
+		delete(c.pending, k)
+	}
+}
+
+// load: puts entry from storage in memory, reports whether there was an entry that isn't expired or older than maxAge
+func (c *cacheManager) load(k key, maxAge time.Duration) bool {
+	body, stored, expires, err := c.storage.GetCache(context.Background(), k.supplier, k.region, k.query)
+	if err != nil {
+		log.Println(err.Error())
+		return false
+	}
+	if body == nil || time.Now().After(expires) {
+		return false
+	}
+	var data []response
+	if err = json.Unmarshal(body, &data); err != nil {
+		log.Println(err.Error())
+		return false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.add(&entry{key: k, data: data, stored: stored, expires: expires})
+	c.stats.Loaded++
+	return maxAge <= 0 || time.Since(stored) <= maxAge
+}
+
+// ttl: returns TTL of offers of supplier in region
+func (c *cacheManager) ttl(supplier, region string) time.Duration {
+	for _, scope := range []string{supplier + "/" + region, supplier, "*/" + region} {
+		if v, fd := c.ttls[scope]; fd {
+			return v
+		}
+	}
+	return c.Options.TTL
 }
@@ -0,0 +1,136 @@
+package cachemanager
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stored struct {
+	data    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+type testStorage struct {
+	mtx  sync.Mutex
+	data map[key]stored
+}
+
+func (st *testStorage) SaveCache(ctx context.Context, supplier, region, query string, data []byte, at, expires time.Time) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	st.data[key{supplier: supplier, region: region, query: query}] = stored{data: data, stored: at, expires: expires}
+	return nil
+}
+
+func (st *testStorage) GetCache(ctx context.Context, supplier, region, query string) ([]byte, time.Time, time.Time, error) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	s := st.data[key{supplier: supplier, region: region, query: query}]
+	return s.data, s.stored, s.expires, nil
+}
+
+func (st *testStorage) DeleteCache(ctx context.Context, supplier, region, query string) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	delete(st.data, key{supplier: supplier, region: region, query: query})
+	return nil
+}
+
+func (st *testStorage) DeleteExpiredCache(ctx context.Context) error {
+	return nil
+}
+
+func newCache(t *testing.T, storage Storage, ttls string) *cacheManager {
+	c := New(storage)
+	c.Options = &Options{MaxEntries: 2, TTL: time.Hour, TTLs: ttls, MaxWait: time.Second}
+	require.NoError(t, c.Init())
+	return c
+}
+
+func Test_Key(t *testing.T) {
+	storage := &testStorage{data: map[key]stored{}}
+	c := newCache(t, storage, "")
+	assert.False(t, c.Check("efind", "77", "TL072", 0), "nothing is cached yet")
+	assert.True(t, c.Check("efind", "77", "TL072", 0), "component is being searched for")
+	c.Store("efind", "77", "TL072", []response{{Supplier: "Чип и Дип"}})
+
+	data, ok := c.Get(context.Background(), "efind", "77", "TL072", 0)
+	require.True(t, ok)
+	assert.Equal(t, "Чип и Дип", data[0].Supplier)
+	_, ok = c.Get(context.Background(), "efind", "78", "TL072", 0)
+	assert.False(t, ok, "offers of another region shouldn't be used")
+	_, ok = c.Get(context.Background(), "pricelist", "77", "TL072", 0)
+	assert.False(t, ok, "offers of another supplier shouldn't be used")
+
+	restarted := newCache(t, storage, "")
+	assert.True(t, restarted.Check("efind", "77", "TL072", 0), "offers should be read from storage")
+
+	require.NoError(t, restarted.Purge(context.Background(), "efind", "77", "TL072"))
+	assert.False(t, restarted.Check("efind", "77", "TL072", 0), "purged offers shouldn't be used")
+	assert.Empty(t, storage.data)
+}
+
+func Test_MaxAge(t *testing.T) {
+	c := newCache(t, &testStorage{data: map[key]stored{}}, "")
+	c.Store("efind", "77", "TL072", nil)
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, c.Check("efind", "77", "TL072", time.Hour))
+	assert.False(t, c.Check("efind", "77", "TL072", time.Millisecond), "offers older than max age shouldn't be used")
+	_, ok := c.Get(context.Background(), "efind", "77", "TL072", time.Hour)
+	assert.True(t, ok, "offers should stay for lists without strict max age")
+
+	var s stats
+	body, err := c.GetJSON()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &s))
+	assert.Equal(t, 1, s.Hits)
+	assert.Equal(t, 1, s.Misses)
+	assert.Equal(t, 1, s.Searching)
+	assert.Equal(t, counters{Hits: 1, Misses: 1}, *s.Suppliers["efind"])
+}
+
+func Test_Wait(t *testing.T) {
+	c := newCache(t, &testStorage{data: map[key]stored{}}, "")
+	require.False(t, c.Check("efind", "77", "TL072", 0))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.Store("efind", "77", "TL072", []response{{Supplier: "Чип и Дип"}})
+	}()
+	start := time.Now()
+	_, ok := c.Get(context.Background(), "efind", "77", "TL072", 0)
+	assert.True(t, ok)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "waiter should be woken once offers are stored")
+
+	require.False(t, c.Check("efind", "77", "NE555", 0))
+	c.Release("efind", "77", "NE555")
+	_, ok = c.Get(context.Background(), "efind", "77", "NE555", 0)
+	assert.False(t, ok)
+	assert.False(t, c.Check("efind", "77", "NE555", 0), "failed search should be tried again")
+}
+
+func Test_Evict(t *testing.T) {
+	c := newCache(t, &testStorage{data: map[key]stored{}}, "efind=1h,pricelist=1ms,*/78=2h")
+	c.Store("pricelist", "77", "TL072", nil)
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, c.get(key{supplier: "pricelist", region: "77", query: "TL072"}, 0), "offers should expire after TTL of supplier")
+
+	c.Store("efind", "77", "A", nil)
+	c.Store("efind", "77", "B", nil)
+	c.get(key{supplier: "efind", region: "77", query: "A"}, 0)
+	c.Store("efind", "77", "C", nil)
+	assert.Equal(t, 2, c.lru.Len())
+	assert.Nil(t, c.get(key{supplier: "efind", region: "77", query: "B"}, 0), "the least recently used entry should be evicted")
+
+	assert.Equal(t, 2*time.Hour, c.ttl("efind2", "78"))
+	assert.Equal(t, time.Hour, c.ttl("efind", "78"))
+
+	c.Options.TTLs = "efind"
+	assert.Error(t, c.Init())
+}
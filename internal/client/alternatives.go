@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+)
+
+// getParentRegion: returns region one level higher to check for alternatives, empty string
+// if region is a country or isn't known
+func (c *client) getParentRegion(region string) string {
+	return c.regions.Parent(region)
+}
+
+// basePart: returns part number without package and suffix, TL072CDT becomes TL072 and STM32F103C8T6 becomes STM32F103.
+// Everything after a dash or a slash is a suffix, part number ends with the last run of at least two digits
+// or with the last digit if there is no such run
+func basePart(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if i := strings.IndexAny(name, "-/"); i > 0 {
+		name = name[:i]
+	}
+	last, long, run := -1, -1, 0
+	for i, r := range name {
+		if !unicode.IsDigit(r) {
+			run = 0
+			continue
+		}
+		run++
+		last = i + utf8.RuneLen(r)
+		if run >= 2 {
+			long = last
+		}
+	}
+	switch {
+	case long != -1:
+		return name[:long]
+	case last != -1:
+		return name[:last]
+	}
+	return name
+}
+
+// alternatives: searches for variants of a part in region of a list and for the same part
+// and its variants in parent regions up to a country until there is enough of them in stock.
+// Cached offers are used even if check was requested through API, only the part itself is searched for again
+func (c *client) alternatives(ctx context.Context, comp component) []jsonResp {
+	base := basePart(comp.name)
+	cached := comp
+	cached.fresh = false
+	seen := make(map[string]bool)
+	var output []jsonResp
+	var total int
+	for region := comp.region; region != "" && total < comp.minAmount; region = c.getParentRegion(region) {
+		data, _, err := c.search(ctx, cached, base, region)
+		if err != nil {
+			log.Println(err.Error())
+			break
+		}
+		for _, supplier := range data {
+			var rows []jsonmodels.Row
+			for _, row := range supplier.Rows {
+				name := strings.ToUpper(row.Name)
+				if !strings.HasPrefix(name, base) || seen[supplier.Stockdata.Title+name] {
+					continue
+				}
+				//the part itself is an alternative only outside region of a list
+				if region == comp.region && name == strings.ToUpper(comp.name) {
+					continue
+				}
+				seen[supplier.Stockdata.Title+name] = true
+				if stock := parseStock(row.Stock); stock != nil {
+					total += *stock
+				}
+				rows = append(rows, row)
+			}
+			if len(rows) != 0 {
+				supplier.Rows = rows
+				output = append(output, jsonResp{supplier})
+			}
+		}
+	}
+	c.rank(output, comp.amount)
+	return output
+}
+
+// rank: sorts parts of every supplier and suppliers themselves by cost of buying amount pieces
+// needed for a build, parts with the same cost or without price are sorted by stock
+func (c *client) rank(data []jsonResp, amount int) {
+	less := func(a, b jsonmodels.Row) bool {
+		costA, costB := c.cost(a, amount), c.cost(b, amount)
+		if costA != costB {
+			return costA < costB
+		}
+		return stockOf(a) > stockOf(b)
+	}
+	for _, supplier := range data {
+		rows := supplier.Rows
+		sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	}
+	sort.SliceStable(data, func(i, j int) bool { return less(data[i].Rows[0], data[j].Rows[0]) })
+}
+
+// cost: returns cost of buying amount pieces in base currency, infinity if it is unknown
+func (c *client) cost(row jsonmodels.Row, amount int) float64 {
+	cost, err := c.pricing.Cost(row.Price, amount)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return cost
+}
+
+// stockOf: returns amount in stock, rows without amount go after ones with it
+func stockOf(row jsonmodels.Row) int {
+	if stock := parseStock(row.Stock); stock != nil {
+		return *stock
+	}
+	return -1
+}
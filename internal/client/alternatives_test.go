@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPricing: cost is price of the first break times amount, parts without price have no cost
+type testPricing struct{}
+
+func (testPricing) Base() string {
+	return jsonmodels.DefaultCurrency
+}
+
+func (testPricing) Cost(prices jsonmodels.Prices, amount int) (float64, error) {
+	if len(prices) == 0 {
+		return 0, errors.New("no price")
+	}
+	return prices[0].Unit * float64(amount), nil
+}
+
+// testSupplier: supplier that counts searches
+type testSupplier struct {
+	searches int
+}
+
+func (s *testSupplier) Name() string {
+	return "efind"
+}
+
+func (s *testSupplier) Search(ctx context.Context, part, region string) ([]jsonmodels.JSONResponse, error) {
+	s.searches++
+	return nil, nil
+}
+
+// testCache: cache that has offers for every part
+type testCache struct {
+	CacheManager
+}
+
+func (testCache) Check(supplier, region, query string, maxAge time.Duration) bool {
+	return true
+}
+
+func (testCache) Get(ctx context.Context, supplier, region, query string, maxAge time.Duration) ([]jsonmodels.JSONResponse, bool) {
+	return []jsonmodels.JSONResponse{{Supplier: supplier, Rows: []jsonmodels.Row{{Name: query + "CDT", Stock: "1"}}}}, true
+}
+
+// testRegions: region 2 is in region 1
+type testRegions struct{}
+
+func (testRegions) Parent(id string) string {
+	if id == "2" {
+		return "1"
+	}
+	return ""
+}
+
+func Test_BasePart(t *testing.T) {
+	for name, want := range map[string]string{
+		"TL072":         "TL072",
+		"TL072CDT":      "TL072",
+		" tl072cp ":     "TL072",
+		"NE555P":        "NE555",
+		"STM32F103C8T6": "STM32F103",
+		"STM32F407VGT6": "STM32F407",
+		"STM8S003F3P6":  "STM8S003",
+		"PIC16F877A":    "PIC16F877",
+		"SN74HC595N":    "SN74HC595",
+		"1N4148":        "1N4148",
+		"2N2222A":       "2N2222",
+		"ATMEGA328P-PU": "ATMEGA328",
+		"LM1117-3.3":    "LM1117",
+		"MCP23017-E/SP": "MCP23017",
+		"ESP32-WROOM":   "ESP32",
+		"R1":            "R1",
+		"LED":           "LED",
+	} {
+		assert.Equal(t, want, basePart(name), name)
+	}
+}
+
+func Test_Rank(t *testing.T) {
+	price := func(unit float64) jsonmodels.Prices {
+		return jsonmodels.Prices{{Quantity: 1, Unit: unit, Currency: jsonmodels.DefaultCurrency}}
+	}
+	c := &client{pricing: testPricing{}}
+	data := []jsonResp{
+		{jsonmodels.JSONResponse{Supplier: "expensive", Rows: []jsonmodels.Row{
+			{Name: "TL072CP", Price: price(30), Stock: "100"},
+		}}},
+		{jsonmodels.JSONResponse{Supplier: "cheap", Rows: []jsonmodels.Row{
+			{Name: "TL072ACP", Stock: "1000"},
+			{Name: "TL072CDT", Price: price(10), Stock: "5"},
+			{Name: "TL072CD", Price: price(10), Stock: "50"},
+			{Name: "TL072BCP", Price: price(20), Stock: "под заказ"},
+		}}},
+		{jsonmodels.JSONResponse{Supplier: "no prices", Rows: []jsonmodels.Row{
+			{Name: "TL072IP", Stock: "под заказ"},
+			{Name: "TL072ID", Stock: "10"},
+		}}},
+	}
+	c.rank(data, 10)
+
+	var suppliers []string
+	for _, supplier := range data {
+		suppliers = append(suppliers, supplier.Supplier)
+	}
+	assert.Equal(t, []string{"cheap", "expensive", "no prices"}, suppliers, "suppliers should be ranked by their cheapest part")
+	var parts []string
+	for _, row := range data[0].Rows {
+		parts = append(parts, row.Name)
+	}
+	assert.Equal(t, []string{"TL072CD", "TL072CDT", "TL072BCP", "TL072ACP"}, parts,
+		"parts with the same cost should go by stock and parts without price should go last")
+	assert.Equal(t, "TL072ID", data[2].Rows[0].Name, "parts without price should go by stock")
+}
+
+func Test_AlternativesUseCache(t *testing.T) {
+	supplier := &testSupplier{}
+	c := &client{cacheManager: testCache{}, regions: testRegions{}, pricing: testPricing{},
+		Suppliers: map[string]Supplier{"efind": supplier}}
+	alts := c.alternatives(context.Background(), component{id: "list", name: "TL072CP", region: "2", minAmount: 10, fresh: true})
+	assert.NotEmpty(t, alts)
+	assert.Zero(t, supplier.searches, "alternatives of a check requested through API should come from cache")
+}
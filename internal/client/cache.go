@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+)
+
+// GetCached: returns merged cached offers of suppliers of list id for component name in region of a list,
+// waits for offers of suppliers that are being searched for
+func (c *client) GetCached(ctx context.Context, id, name string) ([]byte, error) {
+	comp, err := c.component(id, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	var output []jsonmodels.JSONResponse
+	var cached bool
+	for _, supplier := range c.suppliers(comp) {
+		data, ok := c.cacheManager.Get(ctx, supplier, comp.region, name, comp.maxAge)
+		if ok {
+			cached = true
+			output = append(output, data...)
+		}
+	}
+	if !cached {
+		return nil, fmt.Errorf("%w %s", ErrNotCached, name)
+	}
+	return json.Marshal(output)
+}
+
+// PurgeCache: removes cached offers of every supplier of list id for tracked components of a list in its region,
+// item is optional and is either item ID or component name
+func (c *client) PurgeCache(ctx context.Context, id, item string) error {
+	names, _, err := c.storage.GetTracked(ctx, id, item)
+	if err != nil {
+		return err
+	}
+	comp, err := c.component(id, "", nil)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		for _, supplier := range c.suppliers(comp) {
+			if err = c.cacheManager.Purge(ctx, supplier, comp.region, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetCacheJSON: returns cache stats as JSON
+func (c *client) GetCacheJSON() ([]byte, error) {
+	return c.cacheManager.GetJSON()
+}
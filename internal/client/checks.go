@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// task: what component is pushed to scheduler with, job is set for checks requested through API
+type task struct {
+	Record json.RawMessage `json:"record"`
+	Job    string          `json:"job,omitempty"`
+	Fresh  bool            `json:"fresh,omitempty"`
+}
+
+// jobKindCheck: kind of jobs that check components right away, same as in jobs
+const jobKindCheck = "check"
+
+// readTask: returns task from scheduler payload, payload used to be component record itself
+func readTask(payload []byte) task {
+	var t task
+	if err := json.Unmarshal(payload, &t); err != nil || t.Record == nil {
+		return task{Record: payload}
+	}
+	return t
+}
+
+// CheckNow: checks tracked components of a list or one of them right away without cache and returns
+// ID of a job to follow the check, item is either item ID or component name. Checks still keep to quota of suppliers
+func (c *client) CheckNow(ctx context.Context, id, item, actor string) (string, error) {
+	names, records, err := c.storage.GetTracked(ctx, id, item)
+	if err != nil {
+		return "", err
+	}
+	job, err := c.jobs.Create(id, jobKindCheck, actor, names)
+	if err != nil {
+		return "", err
+	}
+	for i, name := range names {
+		payload, err := json.Marshal(task{Record: records[i], Job: job, Fresh: true})
+		if err != nil {
+			return "", err
+		}
+		c.scheduler.Push(id, name, payload, true)
+	}
+	return job, nil
+}
+
+// Report: passes result of a check to its job if check was requested through API, called by scheduler
+func (c *client) Report(id, name string, payload []byte, state string, err error, retry bool) {
+	if t := readTask(payload); t.Job != "" {
+		c.jobs.Update(t.Job, name, state, err, retry)
+	}
+}
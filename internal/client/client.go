@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,22 +13,25 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+	"github.com/icyrogue/ye-keeper/internal/schedule"
 )
 
 type jsonResp struct {
 	jsonmodels.JSONResponse
 }
 type client struct {
-	router              *resty.Client
-	components          []component
 	schemaManager       SchemaManager
 	queueManager        QueueManager
 	notificationManager NotificationManager
 	cacheManager        CacheManager
 	storage             Storage
 	mailTemplate        []byte
+	regions             Regions
+	pricing             Pricing
+	scheduler           Scheduler
+	jobs                Jobs
+	Suppliers           map[string]Supplier
 	Options             *Options
 }
 
@@ -36,22 +40,19 @@ type component struct {
 	minAmount int
 	region    string
 	name      string
-	priority  bool
+	amount    int
+	suppliers []string
+	maxAge    time.Duration
+	fresh     bool
 }
 
 type Options struct {
-	MaxRequestsPer int
 	MaxTimeOutTime int
-	APIToken       string
 	MailTempPath   string
 }
 
-type jsonError struct {
-	Error string `json:"error"`
-}
-
 type QueueManager interface {
-	PushTask(id string, taskType string, body []byte, name string) error
+	PushTask(ctx context.Context, id, taskType, actor string, body []byte) (string, error)
 }
 
 type NotificationManager interface {
@@ -64,28 +65,68 @@ type SchemaManager interface {
 }
 
 type Storage interface {
-	GetComponents(ctx context.Context) ([]string, []string, error)
+	GetComponents(ctx context.Context) ([]string, []string, [][]byte, []bool, error)
+	SetNextCheck(ctx context.Context, id, name string, next time.Time) error
+	GetTracked(ctx context.Context, id, item string) ([]string, [][]byte, error)
+	AddAvailability(ctx context.Context, args [][]interface{}) error
+	GetState(ctx context.Context, id, name string) (string, error)
+	SetState(ctx context.Context, id, name, state string) (string, error)
+}
+
+// Supplier: source of offers for parts, for example EFind or price lists of distributors
+type Supplier interface {
+	Name() string
+	Search(ctx context.Context, part, region string) ([]jsonmodels.JSONResponse, error)
+}
+
+type Pricing interface {
+	Base() string
+	Cost(prices jsonmodels.Prices, amount int) (float64, error)
+}
+
+type Regions interface {
+	Parent(id string) string
+}
+
+// Scheduler: decides when components are checked, components that were never checked go first
+type Scheduler interface {
+	Push(id, name string, payload []byte, priority bool)
+	Len() int
+}
+
+// Jobs: keeps track of checks requested through API
+type Jobs interface {
+	Create(list, kind, actor string, names []string) (string, error)
+	Update(id, name, state string, err error, retry bool)
 }
 
 type CacheManager interface {
-	Check(name string) (cached bool)
-	Get(ctx context.Context, name string) chan []jsonmodels.JSONResponse
-	Store(name string, data []jsonmodels.JSONResponse)
+	Check(supplier, region, query string, maxAge time.Duration) (cached bool)
+	Get(ctx context.Context, supplier, region, query string, maxAge time.Duration) ([]jsonmodels.JSONResponse, bool)
+	Store(supplier, region, query string, data []jsonmodels.JSONResponse)
+	Release(supplier, region, query string)
+	Purge(ctx context.Context, supplier, region, query string) error
+	GetJSON() ([]byte, error)
 }
 
-const (
-	StatusBandWidthLimitExceeded = 509 //EFind "too many requests" code
-	apiURL                       = "https://efind.ru/api/search"
-)
+// defaultAmountField: field of component record with amount needed for one build
+const defaultAmountField = "amount"
+
+// errNoSuppliers: none of suppliers of a list answered
+var errNoSuppliers = errors.New("no supplier answered")
 
-func New(schemaManager SchemaManager, storage Storage, queueManager QueueManager, notificationManager NotificationManager, cacheMnager CacheManager) *client {
-	return &client{router: resty.New(), schemaManager: schemaManager, storage: storage,
-		queueManager: queueManager, notificationManager: notificationManager, cacheManager: cacheMnager}
+// ErrNotCached: none of suppliers of a list has cached offers for a component
+var ErrNotCached = errors.New("couldn't get information about component")
+
+func New(schemaManager SchemaManager, storage Storage, queueManager QueueManager, notificationManager NotificationManager, cacheMnager CacheManager, regions Regions, pricing Pricing, scheduler Scheduler, jobs Jobs) *client {
+	return &client{schemaManager: schemaManager, storage: storage, queueManager: queueManager, notificationManager: notificationManager,
+		cacheManager: cacheMnager, regions: regions, pricing: pricing, scheduler: scheduler, jobs: jobs, Suppliers: make(map[string]Supplier)}
 }
 
+// Start: reads mail template and starts adding components to scheduler every time its queue is empty,
+// scheduler calls Check for them
 func (c *client) Start(ctx context.Context) {
 	ticker := time.NewTicker(time.Second * time.Duration(c.Options.MaxTimeOutTime))
-	var pop component
 	var err error
 	c.mailTemplate, err = os.ReadFile(c.Options.MailTempPath)
 	if err != nil {
@@ -94,154 +135,283 @@ func (c *client) Start(ctx context.Context) {
 	}
 	c.Update()
 	go func() {
-	loop:
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
-				break loop
+				return
 			case <-ticker.C:
-				for i := 0; i < c.Options.MaxRequestsPer; i++ {
-					cut := len(c.components) - 1
-					if cut <= 0 {
-						break
-					}
-					pop = c.components[cut:][0]
-					c.components = c.components[:cut]
-					if !c.cacheManager.Check(pop.name) {
-						go c.check(pop)
-						continue loop
-					}
-					go c.getFromCache(pop)
+				if c.scheduler.Len() == 0 {
+					c.Update()
 				}
-				c.Update()
 			}
 		}
 	}()
 }
 
-// Update: pushes new components to clients array of components to check
+// Update: pushes due components that weren't checked for the longest time to scheduler and sets
+// when they are due next from check interval and quiet window of a list, components that were never
+// checked go to priority lane
 func (c *client) Update() {
-	data, ids, err := c.storage.GetComponents(context.Background())
-	if len(data) == 0 {
-		log.Println(data)
-		return
-	}
+	data, ids, records, fresh, err := c.storage.GetComponents(context.Background())
 	if err != nil {
 		log.Println(err.Error())
 		return
 	}
 	log.Println(data, ids)
+	now := time.Now()
 	for i, id := range ids {
-		comp := component{}
-
-		schema, err := c.schemaManager.GetParams(id)
-		if err != nil {
-			log.Println("client got:", err.Error(), id)
-			continue
+		s := c.schedule(id)
+		next := s.Next(now)
+		if end, quiet := s.QuietUntil(now); quiet {
+			//components aren't checked in quiet window of a list and are due once it ends
+			next = end
+		} else if payload, err := json.Marshal(task{Record: records[i]}); err != nil {
+			log.Println(err.Error())
+		} else {
+			c.scheduler.Push(id, data[i], payload, fresh[i])
 		}
-		minAmount, err := strconv.Atoi(schema["minimumAmount"])
-		if err != nil {
+		if err = c.storage.SetNextCheck(context.Background(), id, data[i], next); err != nil {
 			log.Println(err.Error())
-			continue
 		}
+	}
+}
 
-		comp.id = id
-		comp.minAmount = minAmount
+// schedule: returns schedule of a list, list without one or with incorrect one is checked as often as quota allows
+func (c *client) schedule(id string) *schedule.Schedule {
+	params, err := c.schemaManager.GetParams(id)
+	if err != nil {
+		return &schedule.Schedule{}
+	}
+	s, err := schedule.Parse(params["checkInterval"], params["quietWindow"])
+	if err != nil {
+		log.Println("schedule of", id, err.Error())
+		return &schedule.Schedule{}
+	}
+	return s
+}
 
-		var fd bool
-		comp.region, fd = schema["region"]
+// Check: checks component name of list id and returns its availability state, called by scheduler.
+// Cached offers are used unless check was requested through API, check stops once ctx is done
+func (c *client) Check(ctx context.Context, id, name string, payload []byte) (string, error) {
+	t := readTask(payload)
+	comp, err := c.component(id, name, t.Record)
+	if err != nil {
+		return "", err
+	}
+	comp.fresh = t.Fresh
+	return c.check(ctx, comp)
+}
 
-		if !fd {
-			log.Println(err.Error())
-			continue
+// component: returns component to check with parameters from schema of a list
+func (c *client) component(id, name string, record []byte) (component, error) {
+	schema, err := c.schemaManager.GetParams(id)
+	if err != nil {
+		return component{}, fmt.Errorf("schema of %s: %w", id, err)
+	}
+	minAmount, err := strconv.Atoi(schema["minimumAmount"])
+	if err != nil {
+		return component{}, fmt.Errorf("minimum amount of %s: %w", id, err)
+	}
+	comp := component{id: id, name: name, minAmount: minAmount, region: schema["region"]}
+
+	//suppliers are separated by comma, every supplier is queried if schema has none
+	for _, supplier := range strings.Split(schema["suppliers"], ",") {
+		if supplier = strings.TrimSpace(supplier); supplier != "" {
+			comp.suppliers = append(comp.suppliers, supplier)
 		}
+	}
 
-		comp.name = data[i]
-		c.components = append(c.components, comp)
+	comp.amount = buildAmount(record, schema["amountField"], schema["buildQuantity"])
+	if schema["maxAge"] != "" {
+		if comp.maxAge, err = time.ParseDuration(schema["maxAge"]); err != nil {
+			return component{}, fmt.Errorf("max age of %s: %w", id, err)
+		}
 	}
-	log.Println("components left to check:", len(c.components))
+	return comp, nil
+}
+
+// buildAmount: returns how many pieces of a component are needed, amount from component record
+// is multiplied by build quantity of a list, both are one if they aren't set
+func buildAmount(record []byte, amountField, buildQuantity string) int {
+	if amountField == "" {
+		amountField = defaultAmountField
+	}
+	var component map[string]string
+	if len(record) != 0 {
+		if err := json.Unmarshal(record, &component); err != nil {
+			log.Println(err.Error())
+		}
+	}
+	amount, err := strconv.Atoi(strings.TrimSpace(component[amountField]))
+	if err != nil || amount < 1 {
+		amount = 1
+	}
+	quantity, err := strconv.Atoi(buildQuantity)
+	if err != nil || quantity < 1 {
+		quantity = 1
+	}
+	return amount * quantity
 }
 
 // check: checks availability of components it preferred region
 // if it isnt available checks again for alternatives and informs a user
-func (c *client) check(comp component) {
-	if comp.id == "" {
-		return
-	}
+func (c *client) check(ctx context.Context, comp component) (string, error) {
 	log.Println("checking for", comp.id)
 
-	resp, err := c.router.R().SetQueryParam("access_token", c.Options.APIToken).SetQueryParam("r", comp.region).SetQueryParam("stock", "1").Get(apiURL + "/" + comp.name)
+	respJSON, fetched, err := c.search(ctx, comp, comp.name, comp.region)
 	if err != nil {
-		log.Println(err.Error())
-		return
+		return "", err
 	}
+	//cached offers were saved when they were received
+	if len(fetched) != 0 {
+		if err = c.storage.AddAvailability(ctx, availability(comp, fetched)); err != nil {
+			log.Println(err.Error())
+		}
+	}
+
+	return c.handleResponse(ctx, respJSON, comp)
+}
 
-	if resp.IsError() {
-		log.Println("client got an error")
-		//if client exeeded req limit - push component back into queue
-		if resp.StatusCode() == StatusBandWidthLimitExceeded {
-			log.Println("client exceeded req limits")
-			comp.priority = true
+// search: returns merged offers of every supplier of a component for a part in region and offers
+// that weren't cached, suppliers that fail are skipped unless every one of them does. Temporary error of any supplier
+// is returned right away so that component is checked again instead of getting a state from part of offers.
+// Cached offers of a supplier are used unless they are older than max age of a list or component has to be fresh
+func (c *client) search(ctx context.Context, comp component, part, region string) ([]jsonmodels.JSONResponse, []jsonmodels.JSONResponse, error) {
+	var output, fetched []jsonmodels.JSONResponse
+	var answered bool
+	for _, name := range c.suppliers(comp) {
+		supplier, fd := c.Suppliers[name]
+		if !fd {
+			log.Println("unknown supplier", name, "in schema of", comp.id)
+			continue
 		}
-		var jsonErr jsonError
-		if err = json.Unmarshal(resp.Body(), &jsonErr); err != nil {
-			log.Println(err)
-			return
+		if !comp.fresh && c.cacheManager.Check(name, region, part, comp.maxAge) {
+			//offers are waited for if another list is searching for them, they are searched for if it failed
+			if data, ok := c.cacheManager.Get(ctx, name, region, part, comp.maxAge); ok {
+				answered = true
+				output = append(output, data...)
+				continue
+			}
 		}
-		log.Println(jsonErr.Error)
-		return
+		data, err := supplier.Search(ctx, part, region)
+		if err != nil {
+			c.cacheManager.Release(name, region, part)
+		}
+		if temporary(err) {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err != nil {
+			log.Println(name, "failed to search for", part, err.Error())
+			continue
+		}
+		c.cacheManager.Store(name, region, part, data)
+		answered = true
+		output = append(output, data...)
+		fetched = append(fetched, data...)
+	}
+	if !answered {
+		return nil, nil, fmt.Errorf("%w for %s", errNoSuppliers, part)
 	}
+	return output, fetched, nil
+}
 
-	var respJSON []jsonmodels.JSONResponse
-	err = json.Unmarshal(resp.Body(), &respJSON)
-	if err != nil {
-		log.Println(err.Error())
+// suppliers: returns names of suppliers of a component, every supplier if schema of its list has none
+func (c *client) suppliers(comp component) []string {
+	if len(comp.suppliers) != 0 {
+		return comp.suppliers
 	}
+	names := make([]string, 0, len(c.Suppliers))
+	for name := range c.Suppliers {
+		names = append(names, name)
+	}
+	return names
+}
 
-	c.cacheManager.Store(comp.name, respJSON)
-	if err != nil {
-		log.Println(err.Error())
+// temporary: reports whether supplier failed for a reason that may go away, such as exceeded quota
+func temporary(err error) bool {
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// availability: converts response to rows of availability history, one for every part of every supplier
+func availability(comp component, data []jsonmodels.JSONResponse) [][]interface{} {
+	var output [][]interface{}
+	for _, supplier := range data {
+		for _, row := range supplier.Rows {
+			price, err := json.Marshal(row.Price)
+			if err != nil {
+				log.Println(err.Error())
+				continue
+			}
+			output = append(output, []interface{}{comp.name, comp.region, supplier.Stockdata.Title,
+				row.Name, row.Manufacturer, parseStock(row.Stock), price, supplier.Supplier})
+		}
 	}
+	return output
+}
 
-	err = c.handleResponse(respJSON, comp)
+// parseStock: returns amount in stock without any signs around it, nil if there is no amount
+func parseStock(stock string) *int {
+	amount, err := strconv.Atoi(strings.Trim(stock, "<>=+~ шт."))
 	if err != nil {
-		log.Println(err.Error())
+		return nil
 	}
+	return &amount
 }
 
-func (c *client) handleResponse(data []jsonmodels.JSONResponse, comp component) error {
-	ln := len(data)
-	respJSON := make([]jsonResp, ln)
-	if ln != 0 {
-		for i, rs := range data {
-			respJSON[i] = jsonResp{rs}
+// handleResponse: moves component to a new availability state and returns it, members of a list are notified
+// only when state changes. New state is saved once members are notified, so notification that wasn't sent
+// is sent again when component is checked again
+func (c *client) handleResponse(ctx context.Context, data []jsonmodels.JSONResponse, comp component) (string, error) {
+	current := getState(data, comp.minAmount)
+	prev, err := c.storage.GetState(ctx, comp.id, comp.name)
+	if err != nil {
+		return "", err
+	}
+	if state := transition(prev, current); state != "" {
+		if err = c.notify(ctx, comp, prev, state); err != nil {
+			return "", err
 		}
-		return nil
 	}
-	body, err := c.construct(comp.id, comp.name, respJSON)
+	if _, err = c.storage.SetState(ctx, comp.id, comp.name, current); err != nil {
+		return "", err
+	}
+	return current, nil
+}
+
+// notify: notifies members of a list that component went from prev state to state, alternatives are added
+// unless component is back in stock. Failure to send is temporary so that scheduler retries the check
+func (c *client) notify(ctx context.Context, comp component, prev, state string) error {
+	if prev == "" {
+		prev = stateAvailable
+	}
+	log.Println(comp.name, "in list", comp.id, "went from", prev, "to", state)
+	var alts []jsonResp
+	if state != stateBackInStock {
+		alts = c.alternatives(ctx, comp)
+	}
+	body, err := c.construct(comp.id, comp.name, prev, state, comp.amount, alts)
 	if err != nil {
 		return err
 	}
-	if err := c.notificationManager.Notify(context.Background(), comp.id, body); err != nil {
-		return err
+	if err = c.notificationManager.Notify(ctx, comp.id, body); err != nil {
+		return notifyError{err}
 	}
 	return nil
 }
 
-func (c *client) getFromCache(component component) {
-	data, ok := <-c.cacheManager.Get(context.Background(), component.name)
-	if !ok {
-		log.Println("couldn't get component from cache")
-		return
-	}
-	if err := c.handleResponse(data, component); err != nil {
-		log.Print(err.Error())
-		return
-	}
+// notifyError: members weren't notified, check is retried to notify them again
+type notifyError struct {
+	error
 }
 
-// construct: creates email from template and response
-func (c *client) construct(id, name string, data []jsonResp) ([]byte, error) {
+func (notifyError) Temporary() bool { return true }
+
+func (e notifyError) Unwrap() error { return e.error }
+
+// construct: creates email from template, states and alternatives with cost of amount pieces
+func (c *client) construct(id, name, prev, state string, amount int, data []jsonResp) ([]byte, error) {
 	template := c.mailTemplate
 	if template == nil {
 		return nil, nil
@@ -254,16 +424,26 @@ func (c *client) construct(id, name string, data []jsonResp) ([]byte, error) {
 	r = regexp.MustCompile("{id}")
 	template = r.ReplaceAll(template, []byte(id))
 
+	r = regexp.MustCompile("{prev}")
+	template = r.ReplaceAll(template, []byte(stateNames[prev]))
+
+	r = regexp.MustCompile("{state}")
+	template = r.ReplaceAll(template, []byte(stateNames[state]))
+
 	r = regexp.MustCompile("{time}")
 	template = r.ReplaceAll(template, []byte(time.Now().Format(time.RFC3339)))
 
 	var table bytes.Buffer
 
-	if len(data) == 0 {
+	switch {
+	case state == stateBackInStock:
+	case len(data) == 0:
+		table.WriteString("<h5>Возможные альтернативы</h5>")
 		table.WriteString("Других доступных варинтов нет, попробуйте изменить мин. количество")
-	} else {
+	default:
+		table.WriteString("<h5>Возможные альтернативы</h5>")
 		for _, alt := range data {
-			table.WriteString(alt.toString())
+			table.WriteString(alt.toString(c.pricing, amount))
 		}
 	}
 
@@ -273,13 +453,8 @@ func (c *client) construct(id, name string, data []jsonResp) ([]byte, error) {
 	return template, nil
 }
 
-// getParentRegion: returns new region to check for alternatives
-func (cm *component) getParentRegion() string {
-	return "1"
-}
-
-// toString: converts row from response to alternative for email HTML
-func (r *jsonResp) toString() string {
+// toString: converts row from response to alternative for email HTML with cost of amount pieces
+func (r *jsonResp) toString(pricing Pricing, amount int) string {
 	var output strings.Builder
 	header := `<h3><a href="%s">%s</a> %s</h3>
 	<details>
@@ -292,27 +467,32 @@ func (r *jsonResp) toString() string {
 	header = fmt.Sprintf(header, r.Stockdata.Site, r.Stockdata.Title,
 		r.Stockdata.City, r.Stockdata.Email, r.Stockdata.Limits)
 	output.WriteString(header)
-	//TODO: add price sorting
 	row := `<table border="1" cellspacing="0" cellpadding="0" width="200" align="center"><tr>
 	<th>Название</th>
 	<th>Производитель</th>
 	<th>Наличие</th>
 	<th>Цена</th>
+	<th>Стоимость %d шт.</th>
 	</tr>`
-	output.WriteString(row)
+	output.WriteString(fmt.Sprintf(row, amount))
 	row = `<tr>
 	<td><a href="%s">%s</a></td>
 	<td>%s</td>
 	<td>%s</td>
 	<td>%s</td>
+	<td>%s</td>
 	</tr>`
 	for _, el := range r.Rows {
 		var prices string
 		for _, pr := range el.Price {
-			prices = prices + fmt.Sprintf("\n%v р./шт от %v", pr[1], pr[0])
+			prices = prices + fmt.Sprintf("\n%v %s/шт от %d", pr.Unit, pr.Currency, pr.Quantity)
+		}
+		cost := "нет цены"
+		if total, err := pricing.Cost(el.Price, amount); err == nil {
+			cost = fmt.Sprintf("%.2f %s", total, pricing.Base())
 		}
 		output.WriteString(fmt.Sprintf(row, el.URL, el.Name,
-			el.Manufacturer, el.Stock, prices))
+			el.Manufacturer, el.Stock, prices, cost))
 	}
 	output.WriteString("</table>")
 	return output.String()
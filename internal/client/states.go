@@ -0,0 +1,58 @@
+package client
+
+import "github.com/icyrogue/ye-keeper/internal/jsonmodels"
+
+// Availability states of a component, back in stock is never stored and is only
+// reported when component becomes available after it was low on stock or unavailable
+const (
+	stateAvailable   = "available"
+	stateLowStock    = "low_stock"
+	stateUnavailable = "unavailable"
+	stateBackInStock = "back_in_stock"
+)
+
+// stateNames: state names for notifications
+var stateNames = map[string]string{
+	stateAvailable:   "в наличии",
+	stateLowStock:    "мало на складе",
+	stateUnavailable: "нет в наличии",
+	stateBackInStock: "снова в наличии",
+}
+
+// getState: returns availability state of a component from response, stock of suppliers is summed up
+// and rows without amount in stock are counted as enough. Component is unavailable when none of rows has it in stock
+func getState(data []jsonmodels.JSONResponse, minAmount int) string {
+	var total, rows int
+	for _, supplier := range data {
+		for _, row := range supplier.Rows {
+			rows++
+			stock := parseStock(row.Stock)
+			if stock == nil {
+				return stateAvailable
+			}
+			total += *stock
+		}
+	}
+	switch {
+	case rows == 0 || total == 0:
+		return stateUnavailable
+	case total < minAmount:
+		return stateLowStock
+	}
+	return stateAvailable
+}
+
+// transition: returns state to notify members about or empty string if there was no transition,
+// component that was never checked before is treated as available
+func transition(prev, state string) string {
+	if prev == "" {
+		prev = stateAvailable
+	}
+	if prev == state {
+		return ""
+	}
+	if state == stateAvailable {
+		return stateBackInStock
+	}
+	return state
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStates: storage that keeps only availability states of components
+type testStates struct {
+	Storage
+	states map[string]string
+}
+
+func (st *testStates) GetState(ctx context.Context, id, name string) (string, error) {
+	return st.states[id+name], nil
+}
+
+func (st *testStates) SetState(ctx context.Context, id, name, state string) (string, error) {
+	prev := st.states[id+name]
+	st.states[id+name] = state
+	return prev, nil
+}
+
+type testNotifications struct {
+	sent int
+	down bool
+}
+
+func (n *testNotifications) Notify(ctx context.Context, id string, data []byte) error {
+	if n.down {
+		return errors.New("dial tcp: connection refused")
+	}
+	n.sent++
+	return nil
+}
+
+func response(stocks ...string) []jsonmodels.JSONResponse {
+	var rows []jsonmodels.Row
+	for _, stock := range stocks {
+		rows = append(rows, jsonmodels.Row{Name: "TL072", Stock: stock})
+	}
+	return []jsonmodels.JSONResponse{{Rows: rows}}
+}
+
+func Test_GetState(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []jsonmodels.JSONResponse
+		minAmount int
+		want      string
+	}{
+		{"no suppliers", nil, 10, stateUnavailable},
+		{"no rows", response(), 10, stateUnavailable},
+		{"out of stock everywhere", response("0", "0 шт."), 10, stateUnavailable},
+		{"enough in stock", response("15"), 10, stateAvailable},
+		{"exactly enough", response("10"), 10, stateAvailable},
+		{"stock of suppliers is summed up", response("4", ">6"), 10, stateAvailable},
+		{"not enough in stock", response("4", "5 шт."), 10, stateLowStock},
+		{"unknown stock is counted as enough", response("2", "под заказ"), 10, stateAvailable},
+		{"no amount needed", response("1"), 0, stateAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, getState(tt.data, tt.minAmount))
+		})
+	}
+}
+
+func Test_Transition(t *testing.T) {
+	tests := []struct {
+		prev, state, want string
+	}{
+		//component that was never checked is treated as available
+		{"", stateAvailable, ""},
+		{"", stateLowStock, stateLowStock},
+		{"", stateUnavailable, stateUnavailable},
+		{stateAvailable, stateAvailable, ""},
+		{stateAvailable, stateLowStock, stateLowStock},
+		{stateAvailable, stateUnavailable, stateUnavailable},
+		{stateLowStock, stateLowStock, ""},
+		{stateLowStock, stateAvailable, stateBackInStock},
+		{stateLowStock, stateUnavailable, stateUnavailable},
+		{stateUnavailable, stateUnavailable, ""},
+		{stateUnavailable, stateAvailable, stateBackInStock},
+		{stateUnavailable, stateLowStock, stateLowStock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prev+"->"+tt.state, func(t *testing.T) {
+			assert.Equal(t, tt.want, transition(tt.prev, tt.state))
+		})
+	}
+}
+
+func Test_HandleResponse(t *testing.T) {
+	notifications := &testNotifications{}
+	c := &client{storage: &testStates{states: map[string]string{}}, notificationManager: notifications}
+	comp := component{id: "list", name: "TL072", minAmount: 10}
+
+	for _, step := range []struct {
+		data  []jsonmodels.JSONResponse
+		state string
+		sent  int
+	}{
+		{response("20"), stateAvailable, 0},
+		{response("20"), stateAvailable, 0},
+		{response("5"), stateLowStock, 1},
+		{response("3"), stateLowStock, 1},
+		{nil, stateUnavailable, 2},
+		{nil, stateUnavailable, 2},
+		{response("20"), stateAvailable, 3},
+	} {
+		state, err := c.handleResponse(context.Background(), step.data, comp)
+		require.NoError(t, err)
+		assert.Equal(t, step.state, state)
+		assert.Equal(t, step.sent, notifications.sent, "members should be notified only when state changes")
+	}
+
+	notifications.down = true
+	_, err := c.handleResponse(context.Background(), nil, comp)
+	assert.True(t, temporary(err), "check should be retried when members weren't notified")
+	notifications.down = false
+	state, err := c.handleResponse(context.Background(), nil, comp)
+	require.NoError(t, err)
+	assert.Equal(t, stateUnavailable, state)
+	assert.Equal(t, 4, notifications.sent, "notification that wasn't sent should be sent on the next check")
+}
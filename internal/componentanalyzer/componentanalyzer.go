@@ -2,19 +2,33 @@ package componentanalyzer
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
-
-	"golang.org/x/sync/errgroup"
+	"strings"
+	"sync"
 )
 
 type analyzer struct {
 	encoder Encoder
 	schemaManager SchemaManager
 	input chan []string
-	deleteRequestInput chan []byte
-	group *errgroup.Group
+	options *Options
+	stop chan struct{}
+	workers sync.WaitGroup
+	Uploads Uploads
+}
+
+//Uploads: gets rows of uploads that couldn't be converted
+type Uploads interface {
+	Stored(upload string, err error)
+}
+
+//Options: Workers is how many rows are converted at once, Buffer is how many rows can wait for them,
+//senders block once it's full
+type Options struct {
+	Workers int
+	Buffer int
 }
 
 type Encoder interface {
@@ -28,57 +42,81 @@ type SchemaManager interface {
 
 type worker struct {
 	data []string
-	deleteData []byte
 	output chan []interface{}
 	encoder Encoder
 	schemaManager SchemaManager
 }
 
-func New(encoder Encoder, schemaManager SchemaManager) *analyzer {
+func New(encoder Encoder, schemaManager SchemaManager, options Options) *analyzer {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
 	return &analyzer{
 		encoder: encoder,
 		schemaManager: schemaManager,
-		input: make(chan []string, 5),
-		deleteRequestInput: make(chan []byte, 5),
-		group: &errgroup.Group{},
+		input: make(chan []string, options.Buffer),
+		options: &options,
+		stop: make(chan struct{}),
 	}
 }
 
-//Starts analyzer with specific output chan from storage interface
-func(a *analyzer) Start(ctx context.Context, output chan []interface{}) {
-	go func () {
-	loop:
-	for {
-		select {
-		case delData := <- a.deleteRequestInput:
-			wk := worker{deleteData: delData, output: output, schemaManager: a.schemaManager, encoder: a.encoder}
-			a.group.Go(wk.handleDelete)
-		case data := <- a.input:
-			wk := worker{data: data, output: output, schemaManager: a.schemaManager, encoder: a.encoder }
-			a.group.Go(wk.do)
-		case <- ctx.Done():
-			break loop
-		}
+//Starts analyzer workers with specific output chan from storage interface, workers run until Shutdown
+func(a *analyzer) Start(output chan []interface{}) {
+	for i := 0; i < a.options.Workers; i++ {
+		a.workers.Add(1)
+		go func() {
+			defer a.workers.Done()
+			for {
+				var err error
+				select {
+				case data := <- a.input:
+					wk := worker{data: data, output: output, schemaManager: a.schemaManager, encoder: a.encoder }
+					//row that isn't passed on is reported to its upload
+					if err = wk.do(); err != nil && len(data) > 2 && a.Uploads != nil {
+						a.Uploads.Stored(data[2], fmt.Errorf("%s: %w", strings.Join(data[3:], ";"), err))
+					}
+				case <- a.stop:
+					//rows sent before Shutdown are converted before workers stop
+					if len(a.input) == 0 {
+						return
+					}
+				}
+				if err != nil {
+					log.Println(err.Error())
+				}
+			}
+		}()
 	}
-		err := a.group.Wait()
-		if err != nil {
-			log.Println(err.Error())
-		}
+}
+
+//Shutdown: waits for workers to convert rows that are left in inputs, gives up when ctx is done
+func(a *analyzer) Shutdown(ctx context.Context) error {
+	close(a.stop)
+	stopped := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(stopped)
 	}()
+	select {
+	case <- stopped:
+		return nil
+	case <- ctx.Done():
+		return ctx.Err()
+	}
 }
 
 //do: converts component record to row for db
 func(w *worker) do() error {
 	log.Println("worker got data from", w.data[0])
-	if len(w.data[1:]) == 1 {
+	if len(w.data) < 3 || len(w.data[3:]) == 1 {
 			return errors.New("isnt a proper record")
 	}
 
-	outputData := make([]interface{}, 4)
+	outputData := make([]interface{}, 7)
 	jsonMap := make(map[string]string)
 
 	names, nameField, err := w.schemaManager.GetNames(w.data[0])
-	fields := w.data[1:]
+	fields := w.data[3:]
 	if err != nil {
 		return err
 	}
@@ -98,54 +136,19 @@ func(w *worker) do() error {
 	}
 
 	outputData[0] = w.data[0] //id column id db
-	outputData[1] = w.data[nameField] //component name
+	outputData[1] = jsonMap[names[nameField]] //component name
 	outputData[2] = component //component record itself along with params
 	outputData[3] = true //tracking: TRUE means that component should be tracked
+	outputData[4] = w.data[1] //who uploaded the BOM
+	outputData[5] = "bom" //how component was added
+	outputData[6] = w.data[2] //upload component came with
 
 	w.output <- outputData
 
 	return nil
 }
 
-//Handle delete: convertes delete req to row to append to db
-func(w *worker) handleDelete() error {
-	id := string(w.deleteData[len(w.deleteData)-8:])
-	log.Println("handling delete req for", id)
-
-	jsonMap := make(map[string]string)
-	err := json.Unmarshal(w.deleteData[:len(w.deleteData)-8], &jsonMap)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-
-	params, err := w.schemaManager.GetParams(id)
-	if err != nil {
-		return err
-	}
-
-	body, err := w.encoder.EncodeJSON(jsonMap, params)
-	if err != nil {
-		log.Println(err.Error())
-		return err
-	}
-
-	component := make([]interface{}, 4)
-	component[0] = id
-	component[1] = jsonMap["part name"]
-	component[2] = body
-	component[3] = false
-	w.output <- component
-
-	return nil
-}
-
-//Get input: returns input channel
+//Get input: returns input channel, list ID goes first, actor second, upload third and fields of component after them
 func(a *analyzer) GetInput() chan []string {
 	return a.input
 }
-
-//Get delete input: returns input for delete rows
-func(a *analyzer) GetDeleteInput() chan []byte {
-	return a.deleteRequestInput
-}
@@ -0,0 +1,220 @@
+package costing
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+)
+
+type costing struct {
+	storage       Storage
+	schemaManager SchemaManager
+	pricing       Pricing
+}
+
+type Storage interface {
+	GetOffers(ctx context.Context, id, region string, suppliers []string) ([]byte, error)
+}
+
+type SchemaManager interface {
+	GetParams(id string) (map[string]string, error)
+}
+
+type Pricing interface {
+	Base() string
+	Cost(prices jsonmodels.Prices, amount int) (float64, error)
+}
+
+// item: tracked item of a list with offers from the latest check
+type item struct {
+	Item      string            `json:"item"`
+	Name      string            `json:"name"`
+	Component map[string]string `json:"component"`
+	Offers    []offer           `json:"offers"`
+}
+
+type offer struct {
+	Time         time.Time         `json:"time"`
+	Supplier     string            `json:"supplier"`
+	Part         string            `json:"part"`
+	Manufacturer string            `json:"manufacturer"`
+	Stock        *int              `json:"stock"`
+	Price        jsonmodels.Prices `json:"price"`
+}
+
+// Report: cost of buying components of a list for a number of boards with suppliers offers were chosen from
+type Report struct {
+	ID        string      `json:"id"`
+	Boards    int         `json:"boards"`
+	Currency  string      `json:"currency"`
+	Total     float64     `json:"total"`
+	Suppliers []string    `json:"suppliers"`
+	Lines     []Line      `json:"lines"`
+	Uncovered []Uncovered `json:"uncovered"`
+}
+
+// Line: the cheapest offer that covers amount of a component needed for every board
+type Line struct {
+	Item         string    `json:"item"`
+	Component    string    `json:"component"`
+	Quantity     int       `json:"quantity"`
+	Supplier     string    `json:"supplier"`
+	Part         string    `json:"part"`
+	Manufacturer string    `json:"manufacturer"`
+	Stock        *int      `json:"stock"`
+	Cost         float64   `json:"cost"`
+	Checked      time.Time `json:"checked"`
+}
+
+// Uncovered: component no offer covers with the reason why
+type Uncovered struct {
+	Item      string `json:"item"`
+	Component string `json:"component"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+}
+
+// Reasons a component isn't covered
+const (
+	reasonNotChecked = "not_checked"
+	reasonNoStock    = "not_enough_stock"
+	reasonNoPrice    = "no_price"
+)
+
+// defaultAmountField: field of component record with amount needed for one board, same as in client
+const defaultAmountField = "amount"
+
+func New(storage Storage, schemaManager SchemaManager, pricing Pricing) *costing {
+	return &costing{storage: storage, schemaManager: schemaManager, pricing: pricing}
+}
+
+// GetReport: returns cost of buying every tracked component of a list for boards, build quantity
+// of a list is used if boards isn't positive. Offers are taken from the latest search of every supplier of a list in its region
+func (cs *costing) GetReport(ctx context.Context, id string, boards int) (*Report, error) {
+	schema, err := cs.schemaManager.GetParams(id)
+	if err != nil {
+		return nil, err
+	}
+	if boards < 1 {
+		if boards, err = strconv.Atoi(schema["buildQuantity"]); err != nil || boards < 1 {
+			boards = 1
+		}
+	}
+	amountField := schema["amountField"]
+	if amountField == "" {
+		amountField = defaultAmountField
+	}
+
+	//suppliers are separated by comma like in client, every supplier is used if schema has none
+	var suppliers []string
+	for _, supplier := range strings.Split(schema["suppliers"], ",") {
+		if supplier = strings.TrimSpace(supplier); supplier != "" {
+			suppliers = append(suppliers, supplier)
+		}
+	}
+	body, err := cs.storage.GetOffers(ctx, id, schema["region"], suppliers)
+	if err != nil {
+		return nil, err
+	}
+	var items []item
+	if err = json.Unmarshal(body, &items); err != nil {
+		return nil, err
+	}
+
+	report := &Report{ID: id, Boards: boards, Currency: cs.pricing.Base(), Lines: []Line{}, Uncovered: []Uncovered{},
+		Suppliers: []string{}}
+	chosen := make(map[string]bool)
+	for _, it := range items {
+		amount, err := strconv.Atoi(strings.TrimSpace(it.Component[amountField]))
+		if err != nil || amount < 1 {
+			amount = 1
+		}
+		quantity := amount * boards
+		line, reason := cs.cheapest(it, quantity)
+		if reason != "" {
+			report.Uncovered = append(report.Uncovered, Uncovered{Item: it.Item, Component: it.Name, Quantity: quantity, Reason: reason})
+			continue
+		}
+		report.Lines = append(report.Lines, line)
+		report.Total += line.Cost
+		if !chosen[line.Supplier] {
+			chosen[line.Supplier] = true
+			report.Suppliers = append(report.Suppliers, line.Supplier)
+		}
+	}
+	sort.Strings(report.Suppliers)
+	return report, nil
+}
+
+// cheapest: returns the cheapest offer with enough pieces in stock, offers without amount in stock
+// are counted as enough the same way client does. Reason is returned if there is no such offer
+func (cs *costing) cheapest(it item, quantity int) (Line, string) {
+	if len(it.Offers) == 0 {
+		return Line{}, reasonNotChecked
+	}
+	var line Line
+	reason := reasonNoStock
+	for _, of := range it.Offers {
+		if of.Stock != nil && *of.Stock < quantity {
+			continue
+		}
+		cost, err := cs.pricing.Cost(of.Price, quantity)
+		if err != nil {
+			if reason == reasonNoStock {
+				reason = reasonNoPrice
+			}
+			continue
+		}
+		if reason == "" && cost >= line.Cost {
+			continue
+		}
+		reason = ""
+		line = Line{Item: it.Item, Component: it.Name, Quantity: quantity, Supplier: of.Supplier, Part: of.Part,
+			Manufacturer: of.Manufacturer, Stock: of.Stock, Cost: cost, Checked: of.Time}
+	}
+	return line, reason
+}
+
+// GetJSON: returns report as JSON
+func (cs *costing) GetJSON(ctx context.Context, id string, boards int) ([]byte, error) {
+	report, err := cs.GetReport(ctx, id, boards)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(report)
+}
+
+// GetCSV: returns report as CSV with a row for every component, uncovered ones have reason
+// instead of supplier and the last row has total cost
+func (cs *costing) GetCSV(ctx context.Context, id string, boards int) ([]byte, error) {
+	report, err := cs.GetReport(ctx, id, boards)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	records := [][]string{{"item", "component", "quantity", "supplier", "part", "manufacturer", "stock", "cost", "currency", "uncovered"}}
+	for _, line := range report.Lines {
+		stock := ""
+		if line.Stock != nil {
+			stock = strconv.Itoa(*line.Stock)
+		}
+		records = append(records, []string{line.Item, line.Component, strconv.Itoa(line.Quantity), line.Supplier, line.Part,
+			line.Manufacturer, stock, strconv.FormatFloat(line.Cost, 'f', 2, 64), report.Currency, ""})
+	}
+	for _, un := range report.Uncovered {
+		records = append(records, []string{un.Item, un.Component, strconv.Itoa(un.Quantity), "", "", "", "", "", "", un.Reason})
+	}
+	records = append(records, []string{"total", "", "", "", "", "", "", strconv.FormatFloat(report.Total, 'f', 2, 64), report.Currency, ""})
+	if err = w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
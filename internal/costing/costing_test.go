@@ -0,0 +1,73 @@
+package costing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/icyrogue/ye-keeper/internal/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStorage struct {
+	body      string
+	suppliers []string
+}
+
+func (s *testStorage) GetOffers(ctx context.Context, id, region string, suppliers []string) ([]byte, error) {
+	s.suppliers = suppliers
+	return []byte(s.body), nil
+}
+
+type testSchemas map[string]string
+
+func (s testSchemas) GetParams(id string) (map[string]string, error) {
+	return s, nil
+}
+
+const offers = `[
+{"item": "1", "name": "TL072", "component": {"Part name": "TL072", "Qty": "2"}, "offers": [
+{"supplier": "A", "part": "TL072CP", "stock": 100, "price": [{"quantity": 1, "unit": 30, "currency": "RUB"}]},
+{"supplier": "B", "part": "TL072CDT", "stock": 5, "price": [{"quantity": 1, "unit": 10, "currency": "RUB"}]},
+{"supplier": "C", "part": "TL072ACD", "stock": null, "price": [{"quantity": 1, "unit": 25, "currency": "RUB"}]}]},
+{"item": "2", "name": "NE555", "component": {"Part name": "NE555", "Qty": "1"}, "offers": [
+{"supplier": "A", "part": "NE555P", "stock": 2, "price": [{"quantity": 1, "unit": 5, "currency": "RUB"}]}]},
+{"item": "3", "name": "LM358", "component": {"Part name": "LM358"}, "offers": [
+{"supplier": "A", "part": "LM358N", "stock": 100, "price": []}]},
+{"item": "4", "name": "BC547", "component": {"Part name": "BC547"}, "offers": []}]`
+
+func Test_GetReport(t *testing.T) {
+	p := pricing.New()
+	p.Options = &pricing.Options{Base: "RUB"}
+	require.NoError(t, p.Init())
+	storage := &testStorage{body: offers}
+	cs := New(storage, testSchemas{"region": "1", "amountField": "Qty", "buildQuantity": "3", "suppliers": "efind, pricelist"}, p)
+
+	report, err := cs.GetReport(context.Background(), "list", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Boards)
+	assert.Equal(t, []string{"efind", "pricelist"}, storage.suppliers, "only offers of suppliers of a list should be used")
+	require.Len(t, report.Lines, 1)
+	assert.Equal(t, "C", report.Lines[0].Supplier, "the cheapest offer with enough stock should be chosen")
+	assert.Equal(t, 10, report.Lines[0].Quantity)
+	assert.Equal(t, 250.0, report.Total)
+	assert.Equal(t, []string{"C"}, report.Suppliers)
+	assert.Equal(t, []Uncovered{
+		{Item: "2", Component: "NE555", Quantity: 5, Reason: reasonNoStock},
+		{Item: "3", Component: "LM358", Quantity: 5, Reason: reasonNoPrice},
+		{Item: "4", Component: "BC547", Quantity: 5, Reason: reasonNotChecked},
+	}, report.Uncovered)
+
+	report, err = cs.GetReport(context.Background(), "list", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Boards, "build quantity of a list should be used without boards")
+	assert.Equal(t, 150.0, report.Total)
+
+	body, err := cs.GetCSV(context.Background(), "list", 1)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, "1,TL072,2,B,TL072CDT,,5,20.00,RUB,", lines[1])
+	assert.Equal(t, "total,,,,,,,25.00,RUB,", lines[5])
+}
@@ -0,0 +1,93 @@
+package dbstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type availabilityEntry struct {
+	Time         time.Time       `json:"time"`
+	Region       string          `json:"region"`
+	Supplier     string          `json:"supplier"`
+	Part         string          `json:"part"`
+	Manufacturer string          `json:"manufacturer"`
+	Stock        *int            `json:"stock"`
+	Price        json.RawMessage `json:"price"`
+}
+
+// AddAvailability: saves results of a check, every row has component name, region, supplier,
+// part, manufacturer, stock, price breaks and supplier of keeper offers came from as columns
+func (st *storage) AddAvailability(ctx context.Context, args [][]interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, len(args))
+	//at is TIMESTAMP, times are written in UTC like in other tables and read back with AT TIME ZONE 'UTC'
+	checked := time.Now().UTC()
+	for i, arg := range args {
+		rows[i] = append(arg[:8:8], checked)
+	}
+	_, err := st.db.CopyFrom(ctx, pgx.Identifier{"availability"},
+		[]string{"name", "region", "supplier", "part", "manufacturer", "stock", "price", "source", "at"}, pgx.CopyFromRows(rows))
+	return err
+}
+
+// GetAvailability: returns results of every check of a list item as JSON array from oldest to newest,
+// item is either its ID or component name, region and time range are optional filters
+func (st *storage) GetAvailability(ctx context.Context, id, item, region string, from, to time.Time) ([]byte, error) {
+	var name string
+	err := st.db.QueryRow(ctx, `SELECT name FROM components WHERE id = $1 AND (item::text = $2 OR name = $2) LIMIT 1`,
+		id, item).Scan(&name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	rows, err := st.db.Query(ctx, `SELECT at AT TIME ZONE 'UTC', region, supplier, part, manufacturer, stock, price FROM availability
+WHERE name = $1 AND ($2 = '' OR region = $2) AND at BETWEEN $3 AND $4 ORDER BY at`, name, region, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []availabilityEntry{}
+	for rows.Next() {
+		var entry availabilityEntry
+		err = rows.Scan(&entry.Time, &entry.Region, &entry.Supplier, &entry.Part, &entry.Manufacturer, &entry.Stock, &entry.Price)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(entries)
+}
+
+// GetOffers: returns tracked items of a list as JSON array, every item has its component name, record
+// and offers of every one of suppliers from their latest search for the component in region.
+// Suppliers search at different times because of their cache TTLs, every supplier is used if there are none
+func (st *storage) GetOffers(ctx context.Context, id, region string, suppliers []string) ([]byte, error) {
+	if suppliers == nil {
+		suppliers = []string{}
+	}
+	var body []byte
+	err := st.db.QueryRow(ctx, `SELECT COALESCE(json_agg(i ORDER BY i.name), '[]') FROM
+(SELECT c.item, c.name, c.schema->'component' AS component, COALESCE((SELECT json_agg(json_build_object('time', a.at AT TIME ZONE 'UTC',
+'region', a.region, 'supplier', a.supplier, 'part', a.part, 'manufacturer', a.manufacturer, 'stock', a.stock, 'price', a.price))
+FROM availability a WHERE a.name = c.name AND a.region = $2 AND (cardinality($3::text[]) = 0 OR a.source = ANY($3))
+AND a.at = (SELECT max(at) FROM availability l WHERE l.name = c.name AND l.region = $2 AND l.source IS NOT DISTINCT FROM a.source)), '[]') AS offers
+FROM components c WHERE c.id = $1 AND c.tracking) i`, id, region, suppliers).Scan(&body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,45 @@
+package dbstorage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveCache: saves offers of supplier for query in region until they expire, previous offers are replaced
+func (st *storage) SaveCache(ctx context.Context, supplier, region, query string, data []byte, stored, expires time.Time) error {
+	_, err := st.db.Exec(ctx, `INSERT INTO cache (supplier, region, name, data, stored, expires) VALUES($1, $2, $3, $4, $5, $6)
+ON CONFLICT (supplier, region, name) DO UPDATE SET data = EXCLUDED.data, stored = EXCLUDED.stored, expires = EXCLUDED.expires`,
+		supplier, region, query, data, stored.UTC(), expires.UTC())
+	return err
+}
+
+// GetCache: returns cached offers of supplier for query in region with time they were stored at and expire at,
+// data is nil if there are none
+func (st *storage) GetCache(ctx context.Context, supplier, region, query string) ([]byte, time.Time, time.Time, error) {
+	var data []byte
+	var stored, expires time.Time
+	err := st.db.QueryRow(ctx, `SELECT data, stored, expires FROM cache WHERE supplier = $1 AND region = $2 AND name = $3`,
+		supplier, region, query).Scan(&data, &stored, &expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, time.Time{}, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	return data, stored.UTC(), expires.UTC(), nil
+}
+
+// DeleteCache: removes cached offers of supplier for query in region
+func (st *storage) DeleteCache(ctx context.Context, supplier, region, query string) error {
+	_, err := st.db.Exec(ctx, `DELETE FROM cache WHERE supplier = $1 AND region = $2 AND name = $3`, supplier, region, query)
+	return err
+}
+
+// DeleteExpiredCache: removes expired offers
+func (st *storage) DeleteExpiredCache(ctx context.Context) error {
+	_, err := st.db.Exec(ctx, `DELETE FROM cache WHERE expires < NOW() AT TIME ZONE 'UTC'`)
+	return err
+}
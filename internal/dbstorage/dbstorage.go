@@ -2,9 +2,13 @@ package dbstorage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -17,6 +21,34 @@ type Options struct {
 	Dsn string
 }
 
+// Errors returned by storage
+var (
+	ErrNotFound = errors.New("no list or item with such ID")
+	ErrConflict = errors.New("list already has the same component")
+)
+
+// uniqueViolation: postgres error code for unique index violation
+const uniqueViolation = "23505"
+
+// change: old and new value of a component field, null value means field wasnt there
+type change struct {
+	Old *string `json:"old"`
+	New *string `json:"new"`
+}
+
+type record struct {
+	Component map[string]string `json:"component"`
+}
+
+type historyEntry struct {
+	Item      string            `json:"item"`
+	Component string            `json:"component"`
+	Changes   map[string]change `json:"changes"`
+	Actor     string            `json:"actor"`
+	Source    string            `json:"source"`
+	Time      time.Time         `json:"time"`
+}
+
 func New() *storage {
 	return &storage{}
 }
@@ -28,9 +60,43 @@ func (st *storage) Init() error {
 	}
 	log.Println("connecting to ", st.Options.Dsn)
 	st.db = conn
-	_, err = st.db.Exec(context.Background(), `CREATE table IF NOT EXISTS "components" (id TEXT, name TEXT, schema JSONB, tracking BOOL, lastcheck TIMESTAMP)`)
-	if err != nil {
-		return err
+	tables := []string{
+		`CREATE table IF NOT EXISTS "components" (id TEXT, name TEXT, schema JSONB, tracking BOOL, lastcheck TIMESTAMP)`,
+		`ALTER TABLE components ADD COLUMN IF NOT EXISTS item UUID DEFAULT gen_random_uuid()`,
+		//components used to be appended on every change and keyed by their whole record,
+		//only the latest row of every part of a list is kept
+		`DELETE FROM components c USING (SELECT ctid, row_number() OVER (PARTITION BY id, name ORDER BY ctid DESC) AS n
+FROM components) d WHERE c.ctid = d.ctid AND d.n > 1`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS components_item ON components (item)`,
+		`DROP INDEX IF EXISTS components_record`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS components_name ON components (id, name)`,
+		`CREATE TABLE IF NOT EXISTS history(id TEXT, item UUID, component TEXT, changes JSONB, actor TEXT, source TEXT, at TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS history_list ON history (id, at)`,
+		`CREATE TABLE IF NOT EXISTS availability(name TEXT, region TEXT, supplier TEXT, part TEXT, manufacturer TEXT, stock INTEGER, price JSONB, at TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS availability_name ON availability (name, at)`,
+		//price breaks used to be saved as EFind arrays of quantity and price in roubles
+		`UPDATE availability SET price = (SELECT COALESCE(jsonb_agg(jsonb_build_object('quantity', p->0, 'unit', p->1, 'currency', 'RUB')), '[]')
+FROM jsonb_array_elements(price) p) WHERE jsonb_typeof(price->0) = 'array'`,
+		//source is supplier of keeper offers came from, rows saved before it have none
+		`ALTER TABLE availability ADD COLUMN IF NOT EXISTS source TEXT`,
+		`CREATE TABLE IF NOT EXISTS componentstates(id TEXT, name TEXT, state TEXT, changed TIMESTAMP, UNIQUE(id, name))`,
+		`ALTER TABLE components ADD COLUMN IF NOT EXISTS nextcheck TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS retries(id TEXT, name TEXT, payload JSONB, attempts INTEGER, due TIMESTAMP, reason TEXT, UNIQUE(id, name))`,
+		`CREATE TABLE IF NOT EXISTS cache(supplier TEXT, region TEXT, name TEXT, data JSONB, stored TIMESTAMP, expires TIMESTAMP)`,
+		//offers used to be cached for every supplier of a list at once, such entries can't be told apart and are dropped
+		`ALTER TABLE cache ADD COLUMN IF NOT EXISTS supplier TEXT`,
+		`DELETE FROM cache WHERE supplier IS NULL`,
+		`ALTER TABLE cache DROP CONSTRAINT IF EXISTS cache_region_name_key`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS cache_key ON cache (supplier, region, name)`,
+		`CREATE TABLE IF NOT EXISTS uploads(id TEXT PRIMARY KEY, list TEXT, format TEXT, actor TEXT, status TEXT, body BYTEA,
+rows INTEGER, errors JSONB, created TIMESTAMP, started TIMESTAMP, finished TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS uploads_queued ON uploads (status, created)`,
+		`CREATE TABLE IF NOT EXISTS jobs(id TEXT PRIMARY KEY, data JSONB)`,
+	}
+	for _, table := range tables {
+		if _, err = st.db.Exec(context.Background(), table); err != nil {
+			return err
+		}
 	}
 	log.Println("CONNECTED")
 	return nil
@@ -55,62 +121,367 @@ func (st *storage) NewList(ctx context.Context, id string) (bool, error) {
 	return true, nil
 }
 
-// Converts: all components from list to JSON array
-func (st *storage) GetList(ctx context.Context, id string, pageNum, pageSize int) ([]byte, error) {
-	rows, err := st.db.Query(ctx, `SELECT json_build_object('pageNumber', $3::int, 'pageSize', $1::int, 'components', (SELECT json_agg(c) FROM (SELECT comp AS component from(SELECT distinct on (schema->'component') schema->'component' as comp, tracking from components
-ORDER by schema->'component', ctid DESC) as cmps WHERE cmps.tracking = true OFFSET $2 FETCH NEXT $1 row ONLY)
- c));`, pageSize, pageSize*(pageNum-1), pageNum)
+// Converts: all components from list to JSON array, untracked ones are included only if all is true.
+// List exists once it has an owner, lists made before members were kept have only components
+func (st *storage) GetList(ctx context.Context, id string, pageNum, pageSize int, all bool) ([]byte, error) {
+	var exists bool
+	err := st.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM members WHERE id = $1) OR EXISTS(SELECT 1 FROM components WHERE id = $1)`,
+		id).Scan(&exists)
 	if err != nil {
 		return nil, err
 	}
+	if !exists {
+		return nil, ErrNotFound
+	}
 	var body []byte
-	for rows.Next() {
-		err = rows.Scan(&body)
-		if err != nil {
-			return nil, err
-		}
+	err = st.db.QueryRow(ctx, `SELECT json_build_object('pageNumber', $3::int, 'pageSize', $1::int, 'components', (SELECT json_agg(c) FROM
+(SELECT item, schema->'component' AS component, tracking FROM components WHERE id = $4 AND (tracking OR $5)
+ORDER BY schema->'component' OFFSET $2 FETCH NEXT $1 ROWS ONLY) c));`, pageSize, pageSize*(pageNum-1), pageNum, id, all).Scan(&body)
+	if err != nil {
+		return nil, err
 	}
 	log.Println(string(body))
 	return body, nil
 }
 
-// AddItem: adds item from list of arguments for columns
+// AddItem: adds items from list of arguments for columns, item with the same part name that is already in a list gets updated.
+// Items with tracking set to false stop being tracked if they are in a list and are never added.
+// Arguments after columns are who made the change and how, every change is written to history
 func (st *storage) AddItem(ctx context.Context, args [][]interface{}) error {
-	names := []string{"id", "name", "schema", "tracking"}
-	_, err := st.db.CopyFrom(ctx, pgx.Identifier{"components"}, names, pgx.CopyFromRows(args))
+	tx, err := st.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback(ctx)
+
+	for _, arg := range args {
+		actor, source := "", ""
+		if len(arg) >= 6 {
+			actor, _ = arg[4].(string)
+			source, _ = arg[5].(string)
+		}
+		var item, name string
+		if tracking, _ := arg[3].(bool); !tracking {
+			err = tx.QueryRow(ctx, `UPDATE components SET tracking = false WHERE id = $1 AND name = $2
+AND tracking RETURNING item::text, name`, arg[0], arg[1]).Scan(&item, &name)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = writeHistory(ctx, tx, arg[0], item, name, trackingChange(true, false), actor, source)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var wasTracking *bool
+		var oldBody []byte
+		err = tx.QueryRow(ctx, `SELECT tracking, schema FROM components WHERE id = $1 AND name = $2`,
+			arg[0], arg[1]).Scan(&wasTracking, &oldBody)
+		isNew := errors.Is(err, pgx.ErrNoRows)
+		if err != nil && !isNew {
+			return err
+		}
+		err = tx.QueryRow(ctx, `INSERT INTO components (id, name, schema, tracking) VALUES($1, $2, $3, $4)
+ON CONFLICT (id, name) DO UPDATE SET schema = EXCLUDED.schema, tracking = EXCLUDED.tracking
+RETURNING item::text, name`, arg[:4]...).Scan(&item, &name)
+		if err != nil {
+			return err
+		}
+		var oldRec, newRec record
+		if body, ok := arg[2].([]byte); ok {
+			if err = json.Unmarshal(body, &newRec); err != nil {
+				return err
+			}
+		}
+		if len(oldBody) != 0 {
+			if err = json.Unmarshal(oldBody, &oldRec); err != nil {
+				return err
+			}
+		}
+		//fields of an item that is uploaded again are written to history along with tracking
+		changes := diff(oldRec.Component, newRec.Component)
+		if !isNew && (wasTracking == nil || !*wasTracking) {
+			for field, c := range trackingChange(false, true) {
+				changes[field] = c
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if err = writeHistory(ctx, tx, arg[0], item, name, changes, actor, source); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// GetItem: returns component record of an item along with params
+func (st *storage) GetItem(ctx context.Context, id, itemID string) ([]byte, error) {
+	var body []byte
+	err := st.db.QueryRow(ctx, `SELECT schema FROM components WHERE id = $1 AND item::text = $2`, id, itemID).Scan(&body)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// GetItemID: returns ID of an item with given part name
+func (st *storage) GetItemID(ctx context.Context, id, name string) (string, error) {
+	var itemID string
+	err := st.db.QueryRow(ctx, `SELECT item::text FROM components WHERE id = $1 AND name = $2`, id, name).Scan(&itemID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return itemID, nil
 }
 
-// GetComponents: returns a batch of components with IDs for client to check
-// updates timestamp when component was last checked so that next batch has
-// components that werent checked or were checked long time ago
-func (st *storage) GetComponents(ctx context.Context) ([]string, []string, error) {
+// UpdateItem: replaces name and component record of an item, changed fields are written to history
+func (st *storage) UpdateItem(ctx context.Context, id, itemID, name string, schema []byte, actor, source string) error {
+	tx, err := st.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var oldBody []byte
+	err = tx.QueryRow(ctx, `SELECT schema FROM components WHERE id = $1 AND item::text = $2 FOR UPDATE`, id, itemID).Scan(&oldBody)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE components SET name = $3, schema = $4 WHERE id = $1 AND item::text = $2`, id, itemID, name, schema)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrConflict
+		}
+		return err
+	}
+	var oldRec, newRec record
+	if err = json.Unmarshal(oldBody, &oldRec); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(schema, &newRec); err != nil {
+		return err
+	}
+	if changes := diff(oldRec.Component, newRec.Component); len(changes) != 0 {
+		if err = writeHistory(ctx, tx, id, itemID, name, changes, actor, source); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// SetTracking: starts or stops tracking of an item
+func (st *storage) SetTracking(ctx context.Context, id, itemID string, tracking bool, actor, source string) error {
+	tx, err := st.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var name string
+	var wasTracking bool
+	err = tx.QueryRow(ctx, `SELECT name, tracking FROM components WHERE id = $1 AND item::text = $2 FOR UPDATE`, id, itemID).Scan(&name, &wasTracking)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if wasTracking == tracking {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `UPDATE components SET tracking = $3 WHERE id = $1 AND item::text = $2`, id, itemID, tracking)
+	if err != nil {
+		return err
+	}
+	if err = writeHistory(ctx, tx, id, itemID, name, trackingChange(wasTracking, tracking), actor, source); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteItem: removes an item from a list for good, every field is written to history as removed
+func (st *storage) DeleteItem(ctx context.Context, id, itemID, actor, source string) error {
+	tx, err := st.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var name string
+	var body []byte
+	err = tx.QueryRow(ctx, `DELETE FROM components WHERE id = $1 AND item::text = $2 RETURNING name, schema`, id, itemID).Scan(&name, &body)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	var rec record
+	if err = json.Unmarshal(body, &rec); err != nil {
+		return err
+	}
+	if err = writeHistory(ctx, tx, id, itemID, name, diff(rec.Component, nil), actor, source); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetHistory: returns changes of a list as JSON array from newest to oldest, component and
+// time range are optional filters
+func (st *storage) GetHistory(ctx context.Context, id, component string, from, to time.Time) ([]byte, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	//at is TIMESTAMP in UTC, bounds are converted so they compare the same instants
+	rows, err := st.db.Query(ctx, `SELECT item::text, component, changes, actor, source, at AT TIME ZONE 'UTC' FROM history
+WHERE id = $1 AND ($2 = '' OR component = $2) AND at BETWEEN $3 AND $4 ORDER BY at DESC`, id, component, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []historyEntry{}
+	for rows.Next() {
+		var entry historyEntry
+		if err = rows.Scan(&entry.Item, &entry.Component, &entry.Changes, &entry.Actor, &entry.Source, &entry.Time); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(entries)
+}
+
+// writeHistory: records changes of an item made by actor
+func writeHistory(ctx context.Context, tx pgx.Tx, id interface{}, item, name string, changes map[string]change, actor, source string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO history (id, item, component, changes, actor, source, at) VALUES($1, $2, $3, $4, $5, $6, NOW() AT TIME ZONE 'UTC')`,
+		id, item, name, changes, actor, source)
+	return err
+}
+
+// diff: returns every field that differs between old and new component records
+func diff(oldComponent, newComponent map[string]string) map[string]change {
+	changes := make(map[string]change)
+	for field, value := range oldComponent {
+		value := value
+		if newValue, fd := newComponent[field]; !fd || newValue != value {
+			changes[field] = change{Old: &value}
+		}
+	}
+	for field, value := range newComponent {
+		value := value
+		if oldValue, fd := oldComponent[field]; !fd || oldValue != value {
+			ch := changes[field]
+			ch.New = &value
+			changes[field] = ch
+		}
+	}
+	return changes
+}
+
+// trackingChange: change of tracking written to history as a field of its own
+func trackingChange(was, is bool) map[string]change {
+	old, new := "false", "false"
+	if was {
+		old = "true"
+	}
+	if is {
+		new = "true"
+	}
+	return map[string]change{"tracking": {Old: &old, New: &new}}
+}
+
+// GetComponents: returns a batch of components that are due with IDs, component records and whether they were never checked
+// for client to check, updates timestamp when component was last checked so that next batch has
+// components that werent checked or were checked long time ago. Client has to set when component is due next
+func (st *storage) GetComponents(ctx context.Context) ([]string, []string, [][]byte, []bool, error) {
 	var output []string
 	var ids []string
-	rows, err := st.db.Query(ctx, `UPDATE components SET lastcheck = NOW()
-WHERE schema = ANY (SELECT foo.schema FROM (SELECT DISTINCT ON (schema) * FROM components
-ORDER BY schema, ctid DESC)
-as foo WHERE foo.tracking = true ORDER BY foo.lastcheck  FETCH NEXT 9 ROWS ONLY) RETURNING id, name`)
+	var records [][]byte
+	var fresh []bool
+	rows, err := st.db.Query(ctx, `UPDATE components c SET lastcheck = NOW() FROM
+(SELECT item, lastcheck FROM components WHERE tracking AND (nextcheck IS NULL OR nextcheck <= NOW() AT TIME ZONE 'UTC')
+ORDER BY lastcheck NULLS FIRST FETCH NEXT 9 ROWS ONLY) p
+WHERE c.item = p.item RETURNING c.id, c.name, c.schema->'component', p.lastcheck IS NULL`)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var data string
 		var id string
-		err := rows.Scan(&id, &data)
+		var record []byte
+		var never bool
+		err := rows.Scan(&id, &data, &record, &never)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 		output = append(output, data)
 		ids = append(ids, id)
+		records = append(records, record)
+		fresh = append(fresh, never)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, nil, nil, err
 	}
-	if rows.Err() != nil {
+	return output, ids, records, fresh, nil
+}
+
+// GetTracked: returns names and records of tracked components of a list, one for every name. Item is optional
+// and is either item ID or component name
+func (st *storage) GetTracked(ctx context.Context, id, item string) ([]string, [][]byte, error) {
+	rows, err := st.db.Query(ctx, `SELECT DISTINCT ON (name) name, schema->'component' FROM components
+WHERE id = $1 AND tracking AND ($2 = '' OR item::text = $2 OR name = $2) ORDER BY name`, id, item)
+	if err != nil {
 		return nil, nil, err
 	}
-	return output, ids, nil
+	defer rows.Close()
+	var names []string
+	var records [][]byte
+	for rows.Next() {
+		var name string
+		var record []byte
+		if err = rows.Scan(&name, &record); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil, ErrNotFound
+	}
+	return names, records, nil
+}
+
+// SetNextCheck: sets when component of a list is due to be checked next
+func (st *storage) SetNextCheck(ctx context.Context, id, name string, next time.Time) error {
+	_, err := st.db.Exec(ctx, `UPDATE components SET nextcheck = $3 WHERE id = $1 AND name = $2`, id, name, next.UTC())
+	return err
+}
+
+// ResetChecks: makes every component of a list due so that it gets rescheduled with new schema
+func (st *storage) ResetChecks(ctx context.Context, id string) error {
+	_, err := st.db.Exec(ctx, `UPDATE components SET nextcheck = NULL WHERE id = $1`, id)
+	return err
 }
 
 // SyncSchemas: returns every schema from db for schemaManager
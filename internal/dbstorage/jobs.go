@@ -0,0 +1,21 @@
+package dbstorage
+
+import "context"
+
+// SaveJobs: saves JSON array of jobs while keeper is restarted, job with the same ID is replaced
+func (st *storage) SaveJobs(ctx context.Context, data []byte) error {
+	_, err := st.db.Exec(ctx, `INSERT INTO jobs (id, data) SELECT j->>'id', j FROM jsonb_array_elements($1::jsonb) j
+ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data`, data)
+	return err
+}
+
+// TakeJobs: removes every saved job and returns them as JSON array
+func (st *storage) TakeJobs(ctx context.Context) ([]byte, error) {
+	var body []byte
+	err := st.db.QueryRow(ctx, `WITH taken AS (DELETE FROM jobs RETURNING data)
+SELECT COALESCE(json_agg(data), '[]') FROM taken`).Scan(&body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,31 @@
+package dbstorage
+
+import (
+	"context"
+	"time"
+)
+
+// SaveRetry: saves check of a component that has to be retried at due time, previous retry of it is replaced
+func (st *storage) SaveRetry(ctx context.Context, id, name string, payload []byte, attempts int, due time.Time, reason string) error {
+	_, err := st.db.Exec(ctx, `INSERT INTO retries (id, name, payload, attempts, due, reason) VALUES($1, $2, $3, $4, $5, $6)
+ON CONFLICT (id, name) DO UPDATE SET payload = EXCLUDED.payload, attempts = EXCLUDED.attempts, due = EXCLUDED.due, reason = EXCLUDED.reason`,
+		id, name, payload, attempts, due.UTC(), reason)
+	return err
+}
+
+// DeleteRetry: removes retry of a component after it was checked or given up on
+func (st *storage) DeleteRetry(ctx context.Context, id, name string) error {
+	_, err := st.db.Exec(ctx, `DELETE FROM retries WHERE id = $1 AND name = $2`, id, name)
+	return err
+}
+
+// GetRetries: returns every retry as JSON array ordered by due time
+func (st *storage) GetRetries(ctx context.Context) ([]byte, error) {
+	var body []byte
+	err := st.db.QueryRow(ctx, `SELECT COALESCE(json_agg(json_build_object('id', id, 'name', name, 'payload', payload,
+'attempts', attempts, 'due', due AT TIME ZONE 'UTC') ORDER BY due), '[]') FROM retries`).Scan(&body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,42 @@
+package dbstorage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetState: returns availability state of a component in a list, empty if component wasn't checked before
+func (st *storage) GetState(ctx context.Context, id, name string) (string, error) {
+	var state string
+	err := st.db.QueryRow(ctx, `SELECT state FROM componentstates WHERE id = $1 AND name = $2`, id, name).Scan(&state)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// SetState: saves availability state of a component in a list and returns previous one,
+// previous state is empty if component wasn't checked before
+func (st *storage) SetState(ctx context.Context, id, name, state string) (string, error) {
+	var prev *string
+	err := st.db.QueryRow(ctx, `WITH prev AS (SELECT state FROM componentstates WHERE id = $1 AND name = $2)
+INSERT INTO componentstates (id, name, state, changed) VALUES($1, $2, $3, NOW())
+ON CONFLICT (id, name) DO UPDATE SET state = EXCLUDED.state, changed = EXCLUDED.changed WHERE componentstates.state <> EXCLUDED.state
+RETURNING (SELECT state FROM prev)`, id, name, state).Scan(&prev)
+	if errors.Is(err, pgx.ErrNoRows) {
+		//nothing was updated so state stays the same
+		return state, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if prev == nil {
+		return "", nil
+	}
+	return *prev, nil
+}
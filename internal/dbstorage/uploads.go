@@ -0,0 +1,76 @@
+package dbstorage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveUpload: saves upload of a list in format as queued
+func (st *storage) SaveUpload(ctx context.Context, id, list, format, actor string, body []byte) error {
+	_, err := st.db.Exec(ctx, `INSERT INTO uploads (id, list, format, actor, status, body, created)
+VALUES($1, $2, $3, $4, 'queued', $5, NOW() AT TIME ZONE 'UTC')`, id, list, format, actor, body)
+	return err
+}
+
+// CountUploads: returns how many uploads are queued or running, in total and by actor
+func (st *storage) CountUploads(ctx context.Context, actor string) (int, int, error) {
+	var all, byActor int
+	err := st.db.QueryRow(ctx, `SELECT count(*), count(*) FILTER (WHERE actor = $1) FROM uploads
+WHERE status IN ('queued', 'running')`, actor).Scan(&all, &byActor)
+	return all, byActor, err
+}
+
+// NextUpload: marks the oldest queued upload of an actor with less than perActor running uploads as running
+// and returns it as JSON with its body, nil if there are none
+func (st *storage) NextUpload(ctx context.Context, perActor int) ([]byte, error) {
+	var body []byte
+	err := st.db.QueryRow(ctx, `UPDATE uploads SET status = 'running', started = NOW() AT TIME ZONE 'UTC'
+WHERE id = (SELECT q.id FROM uploads q WHERE q.status = 'queued'
+AND (SELECT count(*) FROM uploads r WHERE r.actor = q.actor AND r.status = 'running') < $1
+ORDER BY q.created LIMIT 1 FOR UPDATE SKIP LOCKED)
+RETURNING json_build_object('id', id, 'list', list, 'format', format, 'actor', actor, 'body', encode(body, 'base64'))`, perActor).Scan(&body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// FinishUpload: saves result of an upload, its body isn't needed anymore
+func (st *storage) FinishUpload(ctx context.Context, id, status string, rows int, skipped []string) error {
+	if skipped == nil {
+		skipped = []string{}
+	}
+	_, err := st.db.Exec(ctx, `UPDATE uploads SET status = $2, rows = $3, errors = $4, body = NULL, finished = NOW() AT TIME ZONE 'UTC'
+WHERE id = $1`, id, status, rows, skipped)
+	return err
+}
+
+// ResetUploads: queues uploads that were running when keeper stopped again and removes uploads finished before
+func (st *storage) ResetUploads(ctx context.Context, before time.Time) error {
+	if _, err := st.db.Exec(ctx, `UPDATE uploads SET status = 'queued', started = NULL WHERE status = 'running'`); err != nil {
+		return err
+	}
+	_, err := st.db.Exec(ctx, `DELETE FROM uploads WHERE finished < $1`, before.UTC())
+	return err
+}
+
+// GetUpload: returns upload without its body as JSON
+func (st *storage) GetUpload(ctx context.Context, id string) ([]byte, error) {
+	var body []byte
+	err := st.db.QueryRow(ctx, `SELECT json_build_object('id', id, 'list', list, 'kind', 'upload', 'format', format, 'actor', actor, 'status', status,
+'rows', rows, 'errors', errors, 'created', created AT TIME ZONE 'UTC', 'started', started AT TIME ZONE 'UTC',
+'finished', finished AT TIME ZONE 'UTC') FROM uploads WHERE id = $1`, id).Scan(&body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,105 @@
+package efind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+)
+
+type efind struct {
+	router  *resty.Client
+	Limiter Limiter
+	Options *Options
+}
+
+// Limiter: keeps requests within EFind quota, Wait blocks until request can be made
+// and Limited is called when EFind says quota is exceeded anyway
+type Limiter interface {
+	Wait(ctx context.Context) error
+	Limited()
+}
+
+type Options struct {
+	APIToken string
+}
+
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+const (
+	StatusBandWidthLimitExceeded = 509 //EFind "too many requests" code
+	apiURL                       = "https://efind.ru/api/search"
+	name                         = "efind"
+)
+
+// Errors returned by EFind
+var (
+	ErrBandwidthLimitExceeded = errors.New("efind: exceeded req limits")
+	ErrSearch                 = errors.New("efind: search failed")
+)
+
+// temporaryError: error of a search that may succeed later, such as exceeded quota, server or network error
+type temporaryError struct {
+	err error
+}
+
+func (e temporaryError) Error() string   { return e.err.Error() }
+func (e temporaryError) Unwrap() error   { return e.err }
+func (e temporaryError) Temporary() bool { return true }
+
+func New() *efind {
+	return &efind{router: resty.New()}
+}
+
+// Name: returns name of supplier used in schemas
+func (e *efind) Name() string {
+	return name
+}
+
+// Search: returns offers for a part in region, only offers with stock are returned. Exceeded quota,
+// server and network errors are temporary ones, they have method Temporary
+func (e *efind) Search(ctx context.Context, part, region string) ([]jsonmodels.JSONResponse, error) {
+	if e.Limiter != nil {
+		if err := e.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := e.router.R().SetContext(ctx).SetQueryParam("access_token", e.Options.APIToken).
+		SetQueryParam("r", region).SetQueryParam("stock", "1").Get(apiURL + "/" + part)
+	if err != nil {
+		return nil, temporaryError{fmt.Errorf("%w: %v", ErrSearch, err)}
+	}
+
+	if resp.IsError() {
+		log.Println("efind returned an error")
+		if resp.StatusCode() == StatusBandWidthLimitExceeded {
+			if e.Limiter != nil {
+				e.Limiter.Limited()
+			}
+			return nil, temporaryError{ErrBandwidthLimitExceeded}
+		}
+		if resp.StatusCode() >= 500 {
+			return nil, temporaryError{fmt.Errorf("%w: status %d", ErrSearch, resp.StatusCode())}
+		}
+		var jsonErr jsonError
+		if err = json.Unmarshal(resp.Body(), &jsonErr); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSearch, jsonErr.Error)
+	}
+
+	var output []jsonmodels.JSONResponse
+	if err = json.Unmarshal(resp.Body(), &output); err != nil {
+		return nil, err
+	}
+	for i := range output {
+		output[i].Supplier = name
+	}
+	return output, nil
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+type jobs struct {
+	mtx     sync.Mutex
+	data    map[string]*job
+	storage Storage
+}
+
+// Storage: keeps jobs while keeper is restarted
+type Storage interface {
+	SaveJobs(ctx context.Context, data []byte) error
+	TakeJobs(ctx context.Context) ([]byte, error)
+}
+
+// job: work requested through API such as checking components of a list right away
+type job struct {
+	ID       string     `json:"id"`
+	List     string     `json:"list"`
+	Kind     string     `json:"kind"`
+	Actor    string     `json:"actor"`
+	Status   string     `json:"status"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished"`
+	Items    []*item    `json:"items"`
+	done     chan struct{}
+}
+
+// item: part of a job, for checks it is a component with its availability state
+type item struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	State  string `json:"state,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Statuses of jobs and their items, job fails if any item fails
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusRetrying  = "retrying"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// KindCheck: job that checks components right away
+const KindCheck = "check"
+
+// jobTTL: how long finished jobs are kept
+const jobTTL = time.Hour
+
+// ErrNotFound: there is no job with such ID or it expired
+var ErrNotFound = errors.New("no job with such ID")
+
+func New(storage Storage) *jobs {
+	return &jobs{data: make(map[string]*job), storage: storage}
+}
+
+// Init: loads jobs saved when keeper stopped, saved jobs are removed from storage
+func (js *jobs) Init() error {
+	body, err := js.storage.TakeJobs(context.Background())
+	if err != nil {
+		return err
+	}
+	var saved []*job
+	if err = json.Unmarshal(body, &saved); err != nil {
+		return err
+	}
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	for _, j := range saved {
+		j.done = make(chan struct{})
+		if j.Finished != nil {
+			if time.Since(*j.Finished) > jobTTL {
+				continue
+			}
+			close(j.done)
+		}
+		js.data[j.ID] = j
+	}
+	log.Println("recovered jobs of count", len(js.data))
+	return nil
+}
+
+// Save: saves jobs that haven't expired yet to storage, checks of unfinished jobs are saved by scheduler
+func (js *jobs) Save(ctx context.Context) error {
+	js.mtx.Lock()
+	saved := []*job{}
+	for _, j := range js.data {
+		if j.Finished == nil || time.Since(*j.Finished) <= jobTTL {
+			saved = append(saved, j)
+		}
+	}
+	body, err := json.Marshal(saved)
+	js.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+	return js.storage.SaveJobs(ctx, body)
+}
+
+// Create: creates job of kind for list with an item for every name and returns its ID
+func (js *jobs) Create(list, kind, actor string, names []string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	j := &job{ID: hex.EncodeToString(buf), List: list, Kind: kind, Actor: actor, Status: StatusQueued,
+		Created: time.Now(), Items: make([]*item, len(names)), done: make(chan struct{})}
+	for i, name := range names {
+		j.Items[i] = &item{Name: name, Status: StatusQueued}
+	}
+
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	for id, old := range js.data {
+		if old.Finished != nil && time.Since(*old.Finished) > jobTTL {
+			delete(js.data, id)
+		}
+	}
+	js.data[j.ID] = j
+	return j.ID, nil
+}
+
+// Update: saves result of an item, item is retried later if retry is true. Job finishes once every item does
+func (js *jobs) Update(id, name, state string, err error, retry bool) {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	j, fd := js.data[id]
+	if !fd || j.Finished != nil {
+		return
+	}
+	j.Status = StatusRunning
+	finished, failed := true, false
+	for _, it := range j.Items {
+		if it.Name == name && (it.Status == StatusQueued || it.Status == StatusRetrying) {
+			it.State = state
+			it.Error = ""
+			switch {
+			case retry:
+				it.Status = StatusRetrying
+				it.Error = err.Error()
+			case err != nil:
+				it.Status = StatusFailed
+				it.Error = err.Error()
+			default:
+				it.Status = StatusSucceeded
+			}
+		}
+		finished = finished && (it.Status == StatusSucceeded || it.Status == StatusFailed)
+		failed = failed || it.Status == StatusFailed
+	}
+	if !finished {
+		return
+	}
+	now := time.Now()
+	j.Finished = &now
+	j.Status = StatusSucceeded
+	if failed {
+		j.Status = StatusFailed
+	}
+	close(j.done)
+}
+
+// GetList: returns ID of a list job belongs to
+func (js *jobs) GetList(ctx context.Context, id string) (string, error) {
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	j, fd := js.data[id]
+	if !fd {
+		return "", ErrNotFound
+	}
+	return j.List, nil
+}
+
+// GetJSON: returns job as JSON, waits up to wait for job to finish
+func (js *jobs) GetJSON(ctx context.Context, id string, wait time.Duration) ([]byte, error) {
+	js.mtx.Lock()
+	j, fd := js.data[id]
+	js.mtx.Unlock()
+	if !fd {
+		return nil, ErrNotFound
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-j.done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+	js.mtx.Lock()
+	defer js.mtx.Unlock()
+	return json.Marshal(j)
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStorage struct {
+	data []byte
+}
+
+func (st *testStorage) SaveJobs(ctx context.Context, data []byte) error {
+	st.data = data
+	return nil
+}
+
+func (st *testStorage) TakeJobs(ctx context.Context) ([]byte, error) {
+	data := st.data
+	st.data = nil
+	if data == nil {
+		return []byte("[]"), nil
+	}
+	return data, nil
+}
+
+func Test_Jobs(t *testing.T) {
+	js := New(&testStorage{})
+	id, err := js.Create("list", KindCheck, "someone@example.com", []string{"TL072", "NE555"})
+	require.NoError(t, err)
+	list, err := js.GetList(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, "list", list)
+
+	var j job
+	body, err := js.GetJSON(context.Background(), id, 0)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &j))
+	assert.Equal(t, StatusQueued, j.Status)
+
+	js.Update(id, "TL072", "available", nil, false)
+	js.Update(id, "NE555", "", errors.New("try later"), true)
+	body, err = js.GetJSON(context.Background(), id, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &j))
+	assert.Equal(t, StatusRunning, j.Status, "job shouldn't finish while items are retried")
+	assert.Equal(t, StatusRetrying, j.Items[1].Status)
+
+	go js.Update(id, "NE555", "", errors.New("broken"), false)
+	body, err = js.GetJSON(context.Background(), id, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &j))
+	assert.Equal(t, StatusFailed, j.Status)
+	assert.NotNil(t, j.Finished)
+	assert.Equal(t, &item{Name: "TL072", Status: StatusSucceeded, State: "available"}, j.Items[0])
+	assert.Equal(t, "broken", j.Items[1].Error)
+
+	_, err = js.GetJSON(context.Background(), "nothing", 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_Save(t *testing.T) {
+	storage := &testStorage{}
+	js := New(storage)
+	running, err := js.Create("list", KindCheck, "someone@example.com", []string{"TL072", "NE555"})
+	require.NoError(t, err)
+	js.Update(running, "TL072", "available", nil, false)
+	finished, err := js.Create("list", KindCheck, "someone@example.com", []string{"TL072"})
+	require.NoError(t, err)
+	js.Update(finished, "TL072", "available", nil, false)
+	require.NoError(t, js.Save(context.Background()))
+
+	restarted := New(storage)
+	require.NoError(t, restarted.Init())
+	restarted.Update(running, "NE555", "", nil, false)
+	var j job
+	body, err := restarted.GetJSON(context.Background(), running, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &j))
+	assert.Equal(t, StatusSucceeded, j.Status, "saved job should be finished after restart")
+	assert.Equal(t, StatusSucceeded, j.Items[0].Status)
+
+	body, err = restarted.GetJSON(context.Background(), finished, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &j))
+	assert.Equal(t, StatusSucceeded, j.Status)
+}
@@ -1,16 +1,24 @@
 package jsonmodels
 
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// JSONResponse: offers of one stock, every supplier backend returns them in this shape
 type JSONResponse struct {
 	Rows      []Row     `json:"rows"`
 	Stockdata Stockdata `json:"stockdata"`
+	Supplier  string    `json:"supplier"`
 }
 
 type Row struct {
-	Name         string          `json:"part"`
-	URL          string          `json:"url"`
-	Manufacturer string          `json:"mfg"`
-	Stock        string          `json:"stock"`
-	Price        [][]interface{} `json:"price"`
+	Name         string `json:"part"`
+	URL          string `json:"url"`
+	Manufacturer string `json:"mfg"`
+	Stock        string `json:"stock"`
+	Price        Prices `json:"price"`
 }
 
 type Stockdata struct {
@@ -22,3 +30,73 @@ type Stockdata struct {
 	//	Country string `json:"country"`
 
 }
+
+// Price: price of one piece when at least Quantity pieces are bought
+type Price struct {
+	Quantity int     `json:"quantity"`
+	Unit     float64 `json:"unit"`
+	Currency string  `json:"currency"`
+}
+
+// Prices: price breaks of a part
+type Prices []Price
+
+// DefaultCurrency: currency of prices that don't have one, EFind gives prices in roubles
+const DefaultCurrency = "RUB"
+
+// UnmarshalJSON: reads price breaks as objects or as arrays of quantity, price and optional currency the way EFind sends them.
+// Numbers can be sent as strings, breaks that can't be read are skipped so one of them doesn't spoil the whole offer
+func (p *Prices) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		//price on request and such
+		*p = Prices{}
+		return nil
+	}
+	prices := make(Prices, 0, len(raw))
+	for _, item := range raw {
+		var quantity, unit, currency interface{}
+		var values []interface{}
+		var fields map[string]interface{}
+		switch {
+		case json.Unmarshal(item, &values) == nil:
+			if len(values) < 2 {
+				continue
+			}
+			quantity, unit = values[0], values[1]
+			if len(values) > 2 {
+				currency = values[2]
+			}
+		case json.Unmarshal(item, &fields) == nil:
+			quantity, unit, currency = fields["quantity"], fields["unit"], fields["currency"]
+		default:
+			continue
+		}
+		q, ok := number(quantity)
+		if !ok {
+			continue
+		}
+		price := Price{Quantity: int(q)}
+		if price.Unit, ok = number(unit); !ok {
+			continue
+		}
+		if price.Currency, _ = currency.(string); price.Currency == "" {
+			price.Currency = DefaultCurrency
+		}
+		prices = append(prices, price)
+	}
+	*p = prices
+	return nil
+}
+
+// number: reads a number that can be sent as a string such as "17.38" or "17,38"
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", "."), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
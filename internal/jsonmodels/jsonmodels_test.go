@@ -0,0 +1,37 @@
+package jsonmodels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PricesUnmarshal(t *testing.T) {
+	var row Row
+	require.NoError(t, json.Unmarshal([]byte(`{"part": "TL072CDT", "price": [[1, 17.38], [3300, 9.87, "USD"]]}`), &row))
+	assert.Equal(t, Prices{{Quantity: 1, Unit: 17.38, Currency: DefaultCurrency}, {Quantity: 3300, Unit: 9.87, Currency: "USD"}}, row.Price)
+
+	body, err := json.Marshal(row.Price)
+	require.NoError(t, err)
+	var prices Prices
+	require.NoError(t, json.Unmarshal(body, &prices))
+	assert.Equal(t, row.Price, prices, "prices should be read back the way they are written")
+
+	for body, expected := range map[string]Prices{
+		`[["one", 1], [10, 2.5]]`:                     {{Quantity: 10, Unit: 2.5, Currency: DefaultCurrency}},
+		`[["1", "17.38"], ["100", "9,87", "USD"]]`:    {{Quantity: 1, Unit: 17.38, Currency: DefaultCurrency}, {Quantity: 100, Unit: 9.87, Currency: "USD"}},
+		`[[1, null], null, [5], [10, 3]]`:             {{Quantity: 10, Unit: 3, Currency: DefaultCurrency}},
+		`[{"quantity": "5", "unit": 1.5}, [20, "1"]]`: {{Quantity: 5, Unit: 1.5, Currency: DefaultCurrency}, {Quantity: 20, Unit: 1, Currency: DefaultCurrency}},
+		`"по запросу"`:                                {},
+		`null`:                                        {},
+	} {
+		prices = nil
+		require.NoError(t, json.Unmarshal([]byte(body), &prices), body)
+		assert.Equal(t, expected, prices, body)
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"part": "NE555", "price": [["1", "n/a"], [10, "4.2"]]}`), &row))
+	assert.Equal(t, Prices{{Quantity: 10, Unit: 4.2, Currency: DefaultCurrency}}, row.Price, "broken break shouldn't fail the offer")
+}
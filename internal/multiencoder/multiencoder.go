@@ -7,11 +7,15 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"strings"
 )
 
+// errTruncated: JSON batch ends in the middle of a component
+var errTruncated = errors.New("upload ends in the middle of a component")
+
 type multiEncoder struct {
 	Output                chan []string
 	StorageInterfaceInput chan []interface{}
@@ -46,24 +50,27 @@ func (m *multiEncoder) EncodeJSON(newComponent, params map[string]string) ([]byt
 	return output.Bytes(), nil
 }
 
-// DecodeCSV: reads scv and passes it to worker
-func (m *multiEncoder) DecodeCSV(ctx context.Context, id string, data io.Reader) error {
+// DecodeCSV: reads scv and passes it to worker tagged with upload, returns how many rows were passed
+// and why rows were skipped
+func (m *multiEncoder) DecodeCSV(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error) {
 	reader := csv.NewReader(data)
 	row, err := reader.Read()
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
 	if len(row) == 1 {
 		reader.Comma = ';'
 		row = strings.Split(row[0], ";")
 		if len(row) == 1 {
-			return errors.New("unable to read csv")
+			return 0, nil, errors.New("unable to read csv")
 		}
 	}
 	_, err = m.schemaManager.CompareFieldNames(id, row)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
+	var rows int
+	var skipped []string
 loop:
 	for {
 		select {
@@ -71,23 +78,37 @@ loop:
 			break loop
 		default:
 			row, err := reader.Read()
+			if err == io.EOF {
+				return rows, skipped, nil
+			}
+			//row with wrong number of fields is skipped, the rest of file can still be read
+			if errors.Is(err, csv.ErrFieldCount) {
+				skipped = append(skipped, err.Error())
+				continue
+			}
 			if err != nil {
-				if err == io.EOF {
-					return nil
-				}
-				return err
+				return rows, skipped, err
+			}
+			//ID, actor and upload should always be first in array so worker can find them,
+			//decoding waits while analyzer is busy
+			select {
+			case m.Output <- append([]string{id, actor, upload}, row...):
+				rows++
+			case <-ctx.Done():
+				break loop
 			}
-			//ID should always be first in array so worker can find it
-			m.Output <- append([]string{id}, row...)
 		}
 	}
-	//TODO: add some graceful shutdown roitine
-	return nil
+	//decoding is stopped when keeper stops, the whole upload is decoded again after restart
+	//and rows that were already passed are saved again over themselves
+	return rows, skipped, ctx.Err()
 }
 
-// Decode JSON batch: converts JSON data into rows of components
-func (m *multiEncoder) DecodeJSONBatch(ctx context.Context, id string, data io.Reader) error {
-	var prevLength int
+// Decode JSON batch: converts JSON data into rows of components tagged with upload, returns how many rows were passed
+// and why rows were skipped
+func (m *multiEncoder) DecodeJSONBatch(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error) {
+	var prevLength, rows, n int
+	var skipped []string
 
 	split := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
 		if atEOF && len(data) == 0 {
@@ -95,9 +116,20 @@ func (m *multiEncoder) DecodeJSONBatch(ctx context.Context, id string, data io.R
 		}
 		if i := bytes.IndexByte(data, '}'); i >= 0 {
 			i++
-			return i + 1, data[0:i], nil
+			//separator after a component is skipped along with it
+			switch {
+			case i < len(data):
+				return i + 1, data[0:i], nil
+			case atEOF:
+				return i, data[0:i], nil
+			}
+			return 0, nil, nil
 		}
 		if atEOF {
+			//only the end of array can follow the last component
+			if len(bytes.Trim(data, " \t\r\n[]")) != 0 {
+				return 0, nil, errTruncated
+			}
 			return len(data), data, nil
 		}
 		return 0, nil, nil
@@ -113,6 +145,11 @@ loop:
 		default:
 			jsonMap := make(map[string]string)
 			body := scanner.Bytes()
+			//the end of array after the last component
+			if len(bytes.Trim(body, " \t\r\n]")) == 0 {
+				continue
+			}
+			n++
 			if prevLength == 0 {
 				i := bytes.IndexByte(body, '[')
 				log.Println(i)
@@ -120,6 +157,7 @@ loop:
 			}
 			if err := json.Unmarshal(body, &jsonMap); err != nil {
 				log.Println(err.Error())
+				skipped = append(skipped, fmt.Sprintf("component %d: %s", n, err))
 				continue
 			}
 
@@ -132,38 +170,53 @@ loop:
 				prevLength = l
 				_, err := m.schemaManager.CompareFieldNames(id, names[1:])
 				if err != nil {
-					return err
+					return rows, skipped, err
 				}
 			}
 
-			component := make([]interface{}, 4)
+			component := make([]interface{}, 7)
 			name, fd := jsonMap["part name"]
 			if !fd {
 				log.Println("unable to determine compoennt name")
+				skipped = append(skipped, fmt.Sprintf("component %d: no part name", n))
 				continue
 			}
 
 			params, err := m.schemaManager.GetParams(id)
 			if err != nil {
 				log.Println("couldnt get schema for", id)
-				return errors.New("no schema for id")
+				return rows, skipped, errors.New("no schema for id")
 			}
 
 			body, err = m.EncodeJSON(jsonMap, params)
 			if err != nil {
 				log.Println("unable to encode elemnt of json batch")
+				skipped = append(skipped, fmt.Sprintf("component %d: %s", n, err))
 				continue
 			}
 
-			component[0] = id   //id column id db
-			component[1] = name //component name
-			component[2] = body //component record itself along with params
-			component[3] = true //tracking: TRUE means that component should be tracked
-
-			m.StorageInterfaceInput <- component
+			component[0] = id      //id column id db
+			component[1] = name    //component name
+			component[2] = body    //component record itself along with params
+			component[3] = true    //tracking: TRUE means that component should be tracked
+			component[4] = actor   //who added the component
+			component[5] = "batch" //how component was added
+			component[6] = upload  //upload component came with
+
+			select {
+			case m.StorageInterfaceInput <- component:
+				rows++
+			case <-ctx.Done():
+				break loop
+			}
 			log.Println("got to the end of JSON batch for ID", id)
 		}
 	}
-	//TODO: add some graceful shutdown routine
-	return nil
+	//upload that can't be read to the end fails instead of being saved in part
+	if err := scanner.Err(); err != nil {
+		return rows, skipped, fmt.Errorf("component %d: %w", n+1, err)
+	}
+	//decoding is stopped when keeper stops, the whole upload is decoded again after restart
+	//and rows that were already passed are saved again over themselves
+	return rows, skipped, ctx.Err()
 }
@@ -0,0 +1,40 @@
+package multiencoder
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSchemas struct{}
+
+func (testSchemas) CompareFieldNames(id string, names []string) ([]string, error) {
+	return nil, nil
+}
+
+func (testSchemas) GetParams(id string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func Test_DecodeJSONBatch(t *testing.T) {
+	m := New(testSchemas{})
+	m.StorageInterfaceInput = make(chan []interface{}, 10)
+
+	rows, skipped, err := m.DecodeJSONBatch(context.Background(), "upload", "list", "someone@example.com",
+		strings.NewReader(`[{"part name": "TL072"}, {"part name": "NE555"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Empty(t, skipped)
+
+	rows, _, err = m.DecodeJSONBatch(context.Background(), "upload", "list", "someone@example.com",
+		strings.NewReader(`[{"part name": "TL072"}, {"part name": "NE5`))
+	assert.ErrorIs(t, err, errTruncated, "truncated upload should fail")
+	assert.Equal(t, 1, rows)
+
+	_, _, err = m.DecodeJSONBatch(context.Background(), "upload", "list", "someone@example.com",
+		strings.NewReader(`[{"part name": "`+strings.Repeat("A", 70*1024)+`"}]`))
+	assert.Error(t, err, "component longer than buffer should fail upload")
+}
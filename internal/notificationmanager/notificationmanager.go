@@ -2,7 +2,9 @@ package notificationmanager
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
 
 	mail "github.com/xhit/go-simple-mail/v2"
@@ -24,7 +26,7 @@ type Options struct {
 }
 
 type UserManager interface {
-	GetUser(ctx context.Context, id string) (string, error)
+	GetUsers(ctx context.Context, id string) ([]string, error)
 }
 
 func New(userManager UserManager, options *Options) *notificationManager {
@@ -47,38 +49,50 @@ func New(userManager UserManager, options *Options) *notificationManager {
 	return &notificationManager{userManager: userManager, server: server, client: client}
 }
 
-// Notify: notifies a user with specific ID
+// Notify: notifies every member of a list with specific ID, member that couldn't be notified
+// doesn't stop others from getting notification and every failure is returned in one error
 func (n *notificationManager) Notify(ctx context.Context, id string, data []byte) error {
 	n.mtx.Lock()
 	defer n.mtx.Unlock()
 
-	email, err := n.userManager.GetUser(ctx, id)
+	emails, err := n.userManager.GetUsers(ctx, id)
 	if err != nil {
 		return err
 	}
-	err = n.Send(email, data)
-	if err != nil {
-		return err
+	var failed []string
+	for _, email := range emails {
+		if err = n.Send(email, data); err != nil {
+			log.Println("couldn't notify", email, "about list", id, err.Error())
+			failed = append(failed, email+": "+err.Error())
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("couldn't notify %d of %d members: %s", len(failed), len(emails), strings.Join(failed, "; "))
 	}
 	return nil
 }
 
-// Sends email using SMTP connection
+// Sends email using SMTP connection, returns error if it wasn't sent
 func (n *notificationManager) Send(addr string, body []byte) error {
 	log.Println("preparing to send email to", addr)
+	if n.client == nil {
+		//mail isn't set up, keeper still works without notifications
+		log.Println("mail isn't configured, email to", addr, "isn't sent")
+		return nil
+	}
 	email := mail.NewMSG()
 	email.SetFrom("componentkeeper@gmail.com")
 	email.AddTo(addr)
 	email.SetBodyData(mail.TextHTML, body)
 	if email.Error != nil {
-		log.Fatal(email.Error)
+		return email.Error
 	}
 
 	err := email.Send(n.client)
 	if err != nil {
 		log.Println(err)
-	} else {
-		log.Println("Email Sent to", addr)
+		return err
 	}
+	log.Println("Email Sent to", addr)
 	return nil
 }
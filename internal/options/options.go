@@ -4,13 +4,21 @@ import (
 	"errors"
 	"flag"
 	"os"
+	"time"
 
 	"github.com/icyrogue/ye-keeper/internal/api"
 	"github.com/icyrogue/ye-keeper/internal/asyncstorageinterface"
+	cachemanager "github.com/icyrogue/ye-keeper/internal/cacheManager"
 	"github.com/icyrogue/ye-keeper/internal/client"
+	"github.com/icyrogue/ye-keeper/internal/componentanalyzer"
 	"github.com/icyrogue/ye-keeper/internal/dbstorage"
+	"github.com/icyrogue/ye-keeper/internal/efind"
 	"github.com/icyrogue/ye-keeper/internal/notificationmanager"
+	"github.com/icyrogue/ye-keeper/internal/pricelist"
+	"github.com/icyrogue/ye-keeper/internal/pricing"
 	"github.com/icyrogue/ye-keeper/internal/queuemanager"
+	"github.com/icyrogue/ye-keeper/internal/regions"
+	"github.com/icyrogue/ye-keeper/internal/scheduler"
 	"github.com/icyrogue/ye-keeper/internal/schemamanager"
 	"github.com/icyrogue/ye-keeper/internal/usermanager"
 )
@@ -20,10 +28,18 @@ type Config struct {
 	SchemaManagerOpts    *schemamanager.Options
 	APIOpts              *api.Options
 	QueueOpts            *queuemanager.Options
+	AnalyzerOpts         *componentanalyzer.Options
 	StorageInterfaceOpts *asyncstorageinterface.Options
 	ClientOpts           *client.Options
 	UserManagerOpts      *usermanager.Options
 	MailingOpts          *notificationmanager.Options
+	RegionsOpts          *regions.Options
+	EFindOpts            *efind.Options
+	PriceListOpts        *pricelist.Options
+	PricingOpts          *pricing.Options
+	SchedulerOpts        *scheduler.Options
+	CacheOpts            *cachemanager.Options
+	ShutdownTimeout      time.Duration
 }
 
 func Get() (*Config, error) {
@@ -32,10 +48,17 @@ func Get() (*Config, error) {
 		SchemaManagerOpts:    &schemamanager.Options{},
 		APIOpts:              &api.Options{},
 		QueueOpts:            &queuemanager.Options{},
+		AnalyzerOpts:         &componentanalyzer.Options{},
 		StorageInterfaceOpts: &asyncstorageinterface.Options{},
 		ClientOpts:           &client.Options{},
 		UserManagerOpts:      &usermanager.Options{},
 		MailingOpts:          &notificationmanager.Options{},
+		RegionsOpts:          &regions.Options{},
+		EFindOpts:            &efind.Options{},
+		PriceListOpts:        &pricelist.Options{},
+		PricingOpts:          &pricing.Options{},
+		SchedulerOpts:        &scheduler.Options{},
+		CacheOpts:            &cachemanager.Options{},
 	}
 	flag.StringVar(&cfg.DBOpts.Dsn, "d", "", "database dsn")
 	if err := flag.Lookup("d").Value.Set(os.Getenv("KEEPER_DSN")); err != nil {
@@ -43,12 +66,36 @@ func Get() (*Config, error) {
 	}
 	flag.StringVar(&cfg.SchemaManagerOpts.Filepath, "f", "schemas.json", "path to lists schemas storage")
 	flag.StringVar(&cfg.APIOpts.Port, "p", "8080", "port for api")
-	flag.StringVar(&cfg.QueueOpts.Prefix, "q", "queueCache", "a place to store all cache from queue")
+	flag.DurationVar(&cfg.ShutdownTimeout, "sd", 30*time.Second, "how long to wait for requests, uploads and checks to finish on shutdown")
+	flag.DurationVar(&cfg.APIOpts.RetryAfter, "ra", 30*time.Second, "how long clients are asked to wait when requests are refused as too many")
+	flag.IntVar(&cfg.QueueOpts.Workers, "qw", 2, "uploads of BOM files and batches decoded at once")
+	flag.IntVar(&cfg.QueueOpts.PerUser, "qu", 1, "uploads of one user decoded at once")
+	flag.IntVar(&cfg.QueueOpts.MaxQueued, "qmax", 100, "max uploads waiting to be decoded, more are refused")
+	flag.IntVar(&cfg.QueueOpts.MaxQueuedPerUser, "qmaxu", 10, "max uploads of one user waiting to be decoded, more are refused")
+	flag.IntVar(&cfg.AnalyzerOpts.Workers, "aw", 4, "rows of BOM files converted at once")
+	flag.IntVar(&cfg.AnalyzerOpts.Buffer, "ab", 100, "rows of BOM files waiting to be converted and saved, decoding waits once there are more")
 	flag.IntVar(&cfg.StorageInterfaceOpts.MaxWaitTime, "w", 30, "max wait time")
 	flag.IntVar(&cfg.StorageInterfaceOpts.MaxBufferLength, "b", 30, "max buffer length for storage interface")
 	flag.StringVar(&cfg.ClientOpts.MailTempPath, "ht", "", "path mail template")
-	flag.IntVar(&cfg.ClientOpts.MaxTimeOutTime, "cwt", 60, "max wait time for client")
-	flag.IntVar(&cfg.ClientOpts.MaxRequestsPer, "cmr", 10, "max req per cycle for client")
+	flag.IntVar(&cfg.ClientOpts.MaxTimeOutTime, "cwt", 10, "how often client looks for components to check when scheduler queue is empty, in seconds")
+	flag.IntVar(&cfg.SchedulerOpts.Quota, "sq", 10, "EFind requests allowed per quota period")
+	flag.DurationVar(&cfg.SchedulerOpts.Period, "sp", time.Minute, "EFind quota period")
+	flag.IntVar(&cfg.SchedulerOpts.Burst, "sb", 10, "max EFind requests made at once after a pause")
+	flag.DurationVar(&cfg.SchedulerOpts.MinBackoff, "smin", 30*time.Second, "wait before the first retry of a failed check")
+	flag.DurationVar(&cfg.SchedulerOpts.MaxBackoff, "smax", time.Hour, "max wait between retries of a failed check")
+	flag.IntVar(&cfg.SchedulerOpts.MaxAttempts, "sma", 8, "attempts to check a component before giving up until its next turn")
+	flag.IntVar(&cfg.CacheOpts.MaxEntries, "cs", 10000, "max components with offers kept in memory, the rest are read from database")
+	flag.DurationVar(&cfg.CacheOpts.TTL, "cttl", 6*time.Hour, "how long offers of suppliers are cached")
+	flag.StringVar(&cfg.CacheOpts.TTLs, "cttls", "pricelist=1m", "cache TTLs of suppliers and regions such as efind=6h,efind/77=1h,*/78=2h")
+	flag.DurationVar(&cfg.CacheOpts.MaxWait, "cmw", 20*time.Second, "how long to wait for offers of component that is being checked")
+	flag.StringVar(&cfg.PriceListOpts.Dir, "pl", "pricelists", "directory with price lists of suppliers")
+	flag.DurationVar(&cfg.PriceListOpts.Interval, "pli", time.Minute, "how often directory with price lists is checked for changes")
+	flag.StringVar(&cfg.PricingOpts.Base, "cur", "RUB", "currency costs of components are compared in")
+	flag.StringVar(&cfg.PricingOpts.RatesPath, "rates", "", "path to JSON object with rates of currencies in base currency")
+	flag.StringVar(&cfg.RegionsOpts.Filepath, "rg", "regions.md", "path to regions table with parents of regions")
+	flag.DurationVar(&cfg.UserManagerOpts.TokenTTL, "ttl", 30*24*time.Hour, "lifetime of API tokens")
+	flag.IntVar(&cfg.UserManagerOpts.LoginCodesPerHour, "lcr", 5, "max login codes sent to one email per hour")
+	flag.StringVar(&cfg.UserManagerOpts.Admins, "admins", "", "comma separated E-Mails of users who can change price lists of suppliers")
 
 	flag.StringVar(&cfg.MailingOpts.KeeperMail, "addr", "", "mail address for mailing?")
 	flag.StringVar(&cfg.MailingOpts.KeeperMailPasswd, "pswd", "", "password for mail address for mailing?")
@@ -67,7 +114,7 @@ func Get() (*Config, error) {
 	if tmp = os.Getenv("EFIND_API_TOKEN"); tmp == "" {
 		return &cfg, errors.New("Mandatory value of EFIND_API_TOKEN isnt set")
 	}
-	cfg.ClientOpts.APIToken = tmp
+	cfg.EFindOpts.APIToken = tmp
 
 	flag.Parse()
 	return &cfg, nil
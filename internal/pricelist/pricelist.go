@@ -0,0 +1,323 @@
+package pricelist
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+)
+
+// name: name of supplier used in schemas
+const name = "pricelist"
+
+type priceList struct {
+	mtx   sync.RWMutex
+	files map[string]file
+	// dirMtx: keeps reload from replacing files with a directory read before Save
+	dirMtx sync.Mutex
+
+	Options *Options
+}
+
+type file struct {
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified"`
+	rows     []jsonmodels.Row
+}
+
+type Options struct {
+	Dir      string
+	Interval time.Duration
+}
+
+// Errors returned by price list
+var (
+	ErrInvalidFile = errors.New("invalid price list")
+	ErrInvalidName = errors.New("invalid price list name")
+)
+
+// Names of columns in price lists, compared in lower case
+var (
+	partColumns         = []string{"part", "part number", "part name", "name", "артикул", "наименование", "название"}
+	manufacturerColumns = []string{"mfg", "manufacturer", "brand", "производитель", "бренд"}
+	stockColumns        = []string{"stock", "qty", "quantity", "наличие", "количество", "остаток"}
+	priceColumns        = []string{"price", "цена"}
+	currencyColumns     = []string{"currency", "валюта"}
+)
+
+var (
+	// validName: price lists are named after suppliers that send them
+	validName = regexp.MustCompile(`^[\p{L}\p{N} _.-]+$`)
+	digits    = regexp.MustCompile(`\d+`)
+)
+
+func New() *priceList {
+	return &priceList{files: make(map[string]file)}
+}
+
+// Start: loads price lists from directory and reloads changed ones every interval
+func (p *priceList) Start(ctx context.Context) error {
+	if err := os.MkdirAll(p.Options.Dir, 0o755); err != nil {
+		return err
+	}
+	p.reload()
+	go func() {
+		ticker := time.NewTicker(p.Options.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.reload()
+			}
+		}
+	}()
+	return nil
+}
+
+// Name: returns name of supplier used in schemas
+func (p *priceList) Name() string {
+	return name
+}
+
+// Search: returns offers from every price list with parts that start with part,
+// price lists don't depend on region
+func (p *priceList) Search(ctx context.Context, part, region string) ([]jsonmodels.JSONResponse, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	part = strings.ToUpper(strings.TrimSpace(part))
+	var output []jsonmodels.JSONResponse
+	for _, f := range p.files {
+		var rows []jsonmodels.Row
+		for _, row := range f.rows {
+			if strings.HasPrefix(strings.ToUpper(row.Name), part) {
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) != 0 {
+			output = append(output, jsonmodels.JSONResponse{Rows: rows, Stockdata: jsonmodels.Stockdata{Title: f.Name}, Supplier: name})
+		}
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Stockdata.Title < output[j].Stockdata.Title })
+	return output, nil
+}
+
+// Save: parses uploaded price list and saves it to directory, previous price list
+// with the same name is replaced
+func (p *priceList) Save(listName string, body []byte) error {
+	if !validName.MatchString(listName) || strings.HasPrefix(listName, ".") {
+		return fmt.Errorf("%w %q", ErrInvalidName, listName)
+	}
+	ext := ".csv"
+	if isXLSX(body) {
+		ext = ".xlsx"
+	}
+	rows, err := parse(ext, body)
+	if err != nil {
+		return err
+	}
+
+	p.dirMtx.Lock()
+	defer p.dirMtx.Unlock()
+	for _, old := range []string{".csv", ".xlsx"} {
+		if err = os.Remove(filepath.Join(p.Options.Dir, listName+old)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err = os.WriteFile(filepath.Join(p.Options.Dir, listName+ext), body, 0o644); err != nil {
+		return err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.files[listName+ext] = file{Name: listName, Modified: time.Now(), rows: rows}
+	return nil
+}
+
+// GetJSON: returns names of loaded price lists with time they were changed
+func (p *priceList) GetJSON() ([]byte, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	output := []file{}
+	for _, f := range p.files {
+		output = append(output, f)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return json.Marshal(output)
+}
+
+// reload: loads new and changed price lists from directory and forgets deleted ones
+func (p *priceList) reload() {
+	p.dirMtx.Lock()
+	defer p.dirMtx.Unlock()
+
+	entries, err := os.ReadDir(p.Options.Dir)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	p.mtx.RLock()
+	current := make(map[string]file, len(p.files))
+	for key, f := range p.files {
+		current[key] = f
+	}
+	p.mtx.RUnlock()
+
+	files := make(map[string]file)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".csv" && ext != ".xlsx") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		if f, fd := current[entry.Name()]; fd && !info.ModTime().After(f.Modified) {
+			files[entry.Name()] = f
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(p.Options.Dir, entry.Name()))
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		rows, err := parse(ext, body)
+		if err != nil {
+			log.Println("couldn't load price list", entry.Name(), err.Error())
+			continue
+		}
+		files[entry.Name()] = file{Name: strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())), Modified: info.ModTime(), rows: rows}
+		log.Println("loaded price list", entry.Name(), "with", len(rows), "parts")
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.files = files
+}
+
+// parse: converts price list to rows, first row with part name column is a header
+func parse(ext string, body []byte) ([]jsonmodels.Row, error) {
+	var records [][]string
+	var err error
+	if ext == ".xlsx" {
+		records, err = readXLSX(body)
+	} else {
+		records, err = readCSV(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFile, err)
+	}
+
+	part, manufacturer, stock, currency := -1, -1, -1, -1
+	var prices [][2]int //column and amount price is for
+	var header int
+	for header = 0; header < len(records) && part == -1; header++ {
+		for i, column := range records[header] {
+			column = strings.ToLower(strings.TrimSpace(column))
+			switch {
+			case part == -1 && oneOf(column, partColumns):
+				part = i
+			case manufacturer == -1 && oneOf(column, manufacturerColumns):
+				manufacturer = i
+			case stock == -1 && oneOf(column, stockColumns):
+				stock = i
+			case currency == -1 && oneOf(column, currencyColumns):
+				currency = i
+			case startsWithOneOf(column, priceColumns):
+				prices = append(prices, [2]int{i, priceBreak(column)})
+			}
+		}
+		if part == -1 {
+			manufacturer, stock, currency, prices = -1, -1, -1, nil
+		}
+	}
+	if part == -1 {
+		return nil, fmt.Errorf("%w: no column with part name", ErrInvalidFile)
+	}
+
+	var rows []jsonmodels.Row
+	for _, record := range records[header:] {
+		row := jsonmodels.Row{Name: strings.TrimSpace(cell(record, part)), Manufacturer: strings.TrimSpace(cell(record, manufacturer)),
+			Stock: strings.TrimSpace(cell(record, stock))}
+		if row.Name == "" {
+			continue
+		}
+		rowCurrency := strings.ToUpper(strings.TrimSpace(cell(record, currency)))
+		if rowCurrency == "" {
+			rowCurrency = jsonmodels.DefaultCurrency
+		}
+		for _, pr := range prices {
+			value := strings.ReplaceAll(strings.TrimSpace(cell(record, pr[0])), ",", ".")
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			row.Price = append(row.Price, jsonmodels.Price{Quantity: pr[1], Unit: price, Currency: rowCurrency})
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readCSV: reads CSV separated by comma or semicolon
+func readCSV(body []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	firstLine, _, _ := bytes.Cut(body, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	return reader.ReadAll()
+}
+
+// priceBreak: returns amount price column is for, "цена от 100" is for 100 pieces, price without amount is for one
+func priceBreak(column string) int {
+	digits := digits.FindString(column)
+	if amount, err := strconv.Atoi(digits); err == nil && amount > 0 {
+		return amount
+	}
+	return 1
+}
+
+func cell(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+func oneOf(column string, names []string) bool {
+	for _, name := range names {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func startsWithOneOf(column string, names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(column, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package pricelist
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPriceList(t *testing.T) *priceList {
+	p := New()
+	p.Options = &Options{Dir: t.TempDir(), Interval: time.Hour}
+	require.NoError(t, p.Start(context.Background()))
+	return p
+}
+
+// testXLSX: builds the smallest XLSX file with shared and inline strings
+func testXLSX(t *testing.T) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>Part number</t></si><si><t>Stock</t></si><si><r><t>TL07</t></r><r><t>2CP</t></r></si><si><t>Currency</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>3</v></c><c r="D1" t="inlineStr"><is><t>Price 10</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>40</v></c><c r="C2" t="inlineStr"><is><t>usd</t></is></c><c r="D2"><v>12.5</v></c></row>
+</sheetData></worksheet>`,
+	}
+	for name, body := range files {
+		w, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func Test_SaveCSV(t *testing.T) {
+	p := newTestPriceList(t)
+	body, err := os.ReadFile("testdata/stock.csv")
+	require.NoError(t, err)
+	require.NoError(t, p.Save("sklad", body))
+
+	offers, err := p.Search(context.Background(), "tl072", "3")
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	assert.Equal(t, "sklad", offers[0].Stockdata.Title)
+	assert.Equal(t, name, offers[0].Supplier)
+	require.Len(t, offers[0].Rows, 2)
+	row := offers[0].Rows[0]
+	assert.Equal(t, "TL072CDT", row.Name)
+	assert.Equal(t, "ST", row.Manufacturer)
+	assert.Equal(t, "1200", row.Stock)
+	assert.Equal(t, jsonmodels.Prices{{Quantity: 1, Unit: 17.38, Currency: "RUB"}, {Quantity: 100, Unit: 9.87, Currency: "RUB"}}, row.Price)
+	assert.Len(t, offers[0].Rows[1].Price, 1, "empty prices should be skipped")
+}
+
+func Test_SaveXLSX(t *testing.T) {
+	p := newTestPriceList(t)
+	require.NoError(t, p.Save("distributor", testXLSX(t)))
+
+	offers, err := p.Search(context.Background(), "TL072", "1")
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	assert.Equal(t, "TL072CP", offers[0].Rows[0].Name)
+	assert.Equal(t, "40", offers[0].Rows[0].Stock)
+	assert.Equal(t, jsonmodels.Prices{{Quantity: 10, Unit: 12.5, Currency: "USD"}}, offers[0].Rows[0].Price)
+	_, err = os.Stat(path.Join(p.Options.Dir, "distributor.xlsx"))
+	assert.NoError(t, err)
+}
+
+func Test_SaveInvalid(t *testing.T) {
+	p := newTestPriceList(t)
+	assert.ErrorIs(t, p.Save("../escape", []byte("part\nTL072")), ErrInvalidName)
+	assert.ErrorIs(t, p.Save("nothing", []byte("foo;bar\n1;2")), ErrInvalidFile)
+}
+
+func Test_WatchedDirectory(t *testing.T) {
+	p := newTestPriceList(t)
+	body, err := os.ReadFile("testdata/stock.csv")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(p.Options.Dir, "dropped.csv"), body, 0o644))
+	p.reload()
+
+	offers, err := p.Search(context.Background(), "NE5532", "")
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	assert.Equal(t, "dropped", offers[0].Stockdata.Title)
+
+	require.NoError(t, os.Remove(path.Join(p.Options.Dir, "dropped.csv")))
+	p.reload()
+	offers, err = p.Search(context.Background(), "NE5532", "")
+	require.NoError(t, err)
+	assert.Empty(t, offers, "deleted price lists should be forgotten")
+}
@@ -0,0 +1,118 @@
+package pricelist
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XLSX is read without any library: only values of the first sheet are needed
+
+type sharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// isXLSX: XLSX files are zip archives
+func isXLSX(body []byte) bool {
+	return bytes.HasPrefix(body, []byte("PK\x03\x04"))
+}
+
+// readXLSX: returns values of cells of the first sheet
+func readXLSX(body []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	var strs sharedStrings
+	if err = decodeXML(archive, "xl/sharedStrings.xml", &strs); err != nil && !errors.Is(err, errNoFile) {
+		return nil, err
+	}
+	shared := make([]string, len(strs.Items))
+	for i, item := range strs.Items {
+		shared[i] = item.Text
+		for _, run := range item.Runs {
+			shared[i] += run.Text
+		}
+	}
+	var sheet worksheet
+	if err = decodeXML(archive, "xl/worksheets/sheet1.xml", &sheet); err != nil {
+		return nil, err
+	}
+
+	records := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var record []string
+		for i, c := range row.Cells {
+			column := i
+			if c.Ref != "" {
+				column = columnIndex(c.Ref)
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n >= len(shared) {
+					return nil, errors.New("wrong shared string in cell " + c.Ref)
+				}
+				record[column] = shared[n]
+			case "inlineStr":
+				record[column] = c.Inline
+			default:
+				record[column] = c.Value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+var errNoFile = errors.New("no such file in xlsx")
+
+func decodeXML(archive *zip.Reader, name string, v interface{}) error {
+	for _, f := range archive.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return xml.NewDecoder(io.LimitReader(r, 64<<20)).Decode(v)
+	}
+	return errNoFile
+}
+
+// columnIndex: converts cell reference such as AB12 to index of a column starting from 0
+func columnIndex(ref string) int {
+	var index int
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+	return index - 1
+}
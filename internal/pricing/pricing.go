@@ -0,0 +1,99 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+)
+
+type pricing struct {
+	rates   map[string]float64
+	Options *Options
+}
+
+type Options struct {
+	Base      string
+	RatesPath string
+}
+
+// Errors returned by pricing
+var (
+	ErrUnknownCurrency = errors.New("no rate for currency")
+	ErrNoPrice         = errors.New("part has no price")
+)
+
+func New() *pricing {
+	return &pricing{rates: make(map[string]float64)}
+}
+
+// Init: loads rates of currencies from JSON object such as {"USD": 61.5}, rate is price of one unit
+// of currency in base currency. Without rates only prices in base currency can be compared
+func (p *pricing) Init() error {
+	p.Options.Base = strings.ToUpper(p.Options.Base)
+	p.rates = map[string]float64{p.Options.Base: 1}
+	if p.Options.RatesPath == "" {
+		return nil
+	}
+	body, err := os.ReadFile(p.Options.RatesPath)
+	if err != nil {
+		return err
+	}
+	var rates map[string]float64
+	if err = json.Unmarshal(body, &rates); err != nil {
+		return fmt.Errorf("rates in %s: %w", p.Options.RatesPath, err)
+	}
+	for currency, rate := range rates {
+		if rate <= 0 {
+			return fmt.Errorf("rate of %s in %s should be positive", currency, p.Options.RatesPath)
+		}
+		p.rates[strings.ToUpper(currency)] = rate
+	}
+	return nil
+}
+
+// Base: returns currency every price is converted to
+func (p *pricing) Base() string {
+	return p.Options.Base
+}
+
+// Convert: converts amount of money in currency to base currency
+func (p *pricing) Convert(amount float64, currency string) (float64, error) {
+	rate, fd := p.rates[strings.ToUpper(currency)]
+	if !fd {
+		return 0, fmt.Errorf("%w %s", ErrUnknownCurrency, currency)
+	}
+	return amount * rate, nil
+}
+
+// Cost: returns cost of buying amount pieces in base currency with the cheapest price break,
+// price break for more pieces than needed means buying that many pieces
+func (p *pricing) Cost(prices jsonmodels.Prices, amount int) (float64, error) {
+	cost := math.Inf(1)
+	var err error
+	for _, price := range prices {
+		unit, convErr := p.Convert(price.Unit, price.Currency)
+		if convErr != nil {
+			err = convErr
+			continue
+		}
+		quantity := amount
+		if price.Quantity > quantity {
+			quantity = price.Quantity
+		}
+		if total := unit * float64(quantity); total < cost {
+			cost = total
+		}
+	}
+	if math.IsInf(cost, 1) {
+		if err != nil {
+			return 0, err
+		}
+		return 0, ErrNoPrice
+	}
+	return cost, nil
+}
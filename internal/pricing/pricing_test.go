@@ -0,0 +1,35 @@
+package pricing
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Cost(t *testing.T) {
+	rates := path.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(rates, []byte(`{"usd": 60}`), 0o600))
+	p := New()
+	p.Options = &Options{Base: "rub", RatesPath: rates}
+	require.NoError(t, p.Init())
+	assert.Equal(t, "RUB", p.Base())
+
+	prices := jsonmodels.Prices{{Quantity: 1, Unit: 20, Currency: "RUB"}, {Quantity: 100, Unit: 0.25, Currency: "USD"}}
+	cost, err := p.Cost(prices, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 200.0, cost)
+
+	cost, err = p.Cost(prices, 80)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500.0, cost, "buying 100 pieces at lower price should be cheaper than 80 at higher one")
+
+	_, err = p.Cost(jsonmodels.Prices{{Quantity: 1, Unit: 1, Currency: "EUR"}}, 1)
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = p.Cost(nil, 1)
+	assert.ErrorIs(t, err, ErrNoPrice)
+}
@@ -1,108 +1,418 @@
 package queuemanager
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
-	"os"
-	"path"
 	"sync"
+	"time"
 )
 
+// queueManager: queue of uploads of lists, uploads are saved to storage before they are decoded
+// so that they survive restart
 type queueManager struct {
-	mtx      sync.RWMutex
-	Options  Options
-	Workers  map[string]func(ctx context.Context, id string, data io.Reader) error
-	queue    []task
-	position int
-	cond     sync.Cond
-	decoder  Decoder
+	mtx     sync.Mutex
+	next    sync.Mutex
+	push    sync.Mutex
+	Workers map[string]Worker
+	Options *Options
+	storage Storage
+	decoder Decoder
+	wake    chan struct{}
+	changed chan struct{}
+	workers sync.WaitGroup
+	abort   context.CancelFunc
+	running map[string]*progress
+	// Flush: asks storage to save rows it holds right away, called while upload waits for its rows
+	Flush func()
 }
 
-type task struct {
-	file string
-	id   string
-	do   func(ctx context.Context, id string, data io.Reader) error
+// progress: rows of an upload that were saved or failed to be saved after they were passed on
+type progress struct {
+	done    int
+	stored  int
+	errors  []string
+	dropped int
+	changed chan struct{}
 }
 
+// Options: Workers is how many uploads are decoded at once, PerUser is how many of them can belong to one user.
+// MaxQueued and MaxQueuedPerUser limit uploads that are queued or running, in total and for one user
 type Options struct {
-	Prefix string
+	Workers          int
+	PerUser          int
+	MaxQueued        int
+	MaxQueuedPerUser int
 }
 
+// Worker: decodes upload of list id and passes its rows on tagged with upload, returns how many rows
+// were passed on and why rows were skipped. Result of every row passed on is reported with Stored
+type Worker func(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error)
+
 type Decoder interface {
-	DecodeCSV(ctx context.Context, id string, data io.Reader) error
-	DecodeJSONBatch(ctx context.Context, id string, data io.Reader) error
+	DecodeCSV(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error)
+	DecodeJSONBatch(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error)
+}
+
+// Storage: keeps uploads with their status
+type Storage interface {
+	SaveUpload(ctx context.Context, id, list, format, actor string, body []byte) error
+	CountUploads(ctx context.Context, actor string) (int, int, error)
+	NextUpload(ctx context.Context, perActor int) ([]byte, error)
+	FinishUpload(ctx context.Context, id, status string, rows int, skipped []string) error
+	ResetUploads(ctx context.Context, before time.Time) error
+	GetUpload(ctx context.Context, id string) ([]byte, error)
 }
 
-func New(decoder Decoder) *queueManager {
-	qm := &queueManager{
+// upload: upload taken from storage to be decoded
+type upload struct {
+	ID     string `json:"id"`
+	List   string `json:"list"`
+	Format string `json:"format"`
+	Actor  string `json:"actor"`
+	Body   []byte `json:"body"`
+}
+
+// Statuses of uploads
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// uploadTTL: how long finished uploads are kept
+const uploadTTL = 7 * 24 * time.Hour
+
+// pollInterval: how often storage is checked for uploads without being woken,
+// uploads left queued after storage error are picked up then
+const pollInterval = time.Minute
+
+// maxSkipped: max number of reasons rows were skipped for saved with upload
+const maxSkipped = 100
+
+// flushInterval: how often storage is asked to save rows while upload waits for them
+const flushInterval = time.Second
+
+// Errors returned by queue manager
+var (
+	ErrUnknownFormat = errors.New("data is in unknown format")
+	ErrBusy          = errors.New("upload queue is full")
+)
+
+func New(decoder Decoder, storage Storage) *queueManager {
+	return &queueManager{
 		decoder: decoder,
-		Workers: make(map[string]func(ctx context.Context, id string, data io.Reader) error),
+		storage: storage,
+		Workers: make(map[string]Worker),
+		wake:    make(chan struct{}, 1),
+		running: make(map[string]*progress),
+		changed: make(chan struct{}),
+	}
+}
+
+// Start: queues uploads that were running when keeper stopped again and starts workers that decode uploads,
+// workers stop taking uploads when ctx is done
+func (qm *queueManager) Start(ctx context.Context) error {
+	if qm.Options.Workers < 1 || qm.Options.PerUser < 1 {
+		return errors.New("queue manager needs at least one worker and one upload per user")
+	}
+	if err := qm.storage.ResetUploads(ctx, time.Now().Add(-uploadTTL)); err != nil {
+		return err
+	}
+	//uploads that are being decoded are only stopped by Shutdown
+	decode, abort := context.WithCancel(context.Background())
+	qm.abort = abort
+	for i := 0; i < qm.Options.Workers; i++ {
+		qm.workers.Add(1)
+		go qm.work(ctx, decode)
 	}
-	qm.cond = *sync.NewCond(&qm.mtx)
-	return qm
+	return nil
 }
 
-// Start: starts up quemanager
-func (qm *queueManager) Start(ctx context.Context) {
+// Shutdown: waits for uploads that are being decoded when ctx given to Start is done, if ctx is done first
+// decoding stops and uploads are decoded again after restart
+func (qm *queueManager) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
 	go func() {
-		for {
-			task := qm.getTask()
-			qm.position++
-			go func() {
-				log.Println("queue manager got new task")
-				file, err := os.Open(path.Join(qm.Options.Prefix, task.file))
-				if err != nil {
-					log.Println(err)
-				}
-				defer file.Close()
-				err = task.do(ctx, task.id, file)
-				if err != nil {
-					log.Println(err)
-				}
-			}()
+		qm.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		if qm.abort != nil {
+			qm.abort()
 		}
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+// work: decodes uploads with decode context until ctx is done, waits to be woken when there are none it can take
+func (qm *queueManager) work(ctx, decode context.Context) {
+	defer qm.workers.Done()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		next, err := qm.nextUpload(ctx)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		if next != nil {
+			//another worker may be idle while there are more uploads
+			qm.notify()
+			qm.do(decode, next)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-qm.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// nextUpload: takes the next upload from storage, one worker at a time so that uploads running
+// for one user aren't counted by several workers at once
+func (qm *queueManager) nextUpload(ctx context.Context) ([]byte, error) {
+	qm.next.Lock()
+	defer qm.next.Unlock()
+	return qm.storage.NextUpload(ctx, qm.Options.PerUser)
+}
+
+// notify: wakes an idle worker if there is one
+func (qm *queueManager) notify() {
+	select {
+	case qm.wake <- struct{}{}:
+	default:
+	}
+}
+
+// do: decodes upload, waits for its rows to be saved and saves its result. Upload is left running
+// if ctx is done so it is queued again on start
+func (qm *queueManager) do(ctx context.Context, body []byte) {
+	var u upload
+	if err := json.Unmarshal(body, &u); err != nil {
+		log.Println(err.Error())
+		return
+	}
+	log.Println("queue manager got upload", u.ID, "for", u.List)
+	p := &progress{changed: make(chan struct{}, 1)}
+	qm.mtx.Lock()
+	qm.running[u.ID] = p
+	qm.mtx.Unlock()
+	defer func() {
+		qm.mtx.Lock()
+		delete(qm.running, u.ID)
+		qm.mtx.Unlock()
 	}()
+
+	status := StatusSucceeded
+	var rows, dropped int
+	var skipped []string
+	worker, fd := qm.Workers[u.Format]
+	if fd {
+		passed, decodeSkipped, err := worker(ctx, u.ID, u.List, u.Actor, bytes.NewReader(u.Body))
+		//rows that were passed on before decoding failed are saved too
+		if !qm.wait(ctx, p, passed) || ctx.Err() != nil {
+			return
+		}
+		qm.mtx.Lock()
+		rows = p.stored
+		skipped = append(decodeSkipped, p.errors...)
+		dropped = p.dropped
+		qm.mtx.Unlock()
+		switch {
+		case err != nil:
+			log.Println(err.Error())
+			status = StatusFailed
+			skipped = append([]string{err.Error()}, skipped...)
+		case passed != 0 && rows == 0:
+			status = StatusFailed
+		}
+	} else {
+		status = StatusFailed
+		skipped = []string{ErrUnknownFormat.Error()}
+	}
+	if len(skipped) > maxSkipped || dropped != 0 {
+		more := dropped
+		if len(skipped) > maxSkipped {
+			more += len(skipped) - maxSkipped
+			skipped = skipped[:maxSkipped]
+		}
+		skipped = append(skipped, fmt.Sprintf("and %d more", more))
+	}
+	if err := qm.storage.FinishUpload(context.Background(), u.ID, status, rows, skipped); err != nil {
+		log.Println(err.Error())
+	}
+
+	qm.mtx.Lock()
+	close(qm.changed)
+	qm.changed = make(chan struct{})
+	qm.mtx.Unlock()
+	//upload of the same user might be waiting for this one to finish
+	qm.notify()
+}
+
+// wait: waits for result of every row passed on, returns false if ctx is done first
+func (qm *queueManager) wait(ctx context.Context, p *progress, passed int) bool {
+	if qm.Flush != nil {
+		qm.Flush()
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		qm.mtx.Lock()
+		done := p.done
+		qm.mtx.Unlock()
+		if done >= passed {
+			return true
+		}
+		select {
+		case <-p.changed:
+		case <-ticker.C:
+			if qm.Flush != nil {
+				qm.Flush()
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
 }
 
-// getTask: returns task first in queue if there isnt any it awaits a signal
-func (qm *queueManager) getTask() task {
+// Stored: reports that row of upload was saved or why it wasn't, called once for every row
+// a worker passed on
+func (qm *queueManager) Stored(upload string, err error) {
 	qm.mtx.Lock()
 	defer qm.mtx.Unlock()
+	p, fd := qm.running[upload]
+	if !fd {
+		return
+	}
+	p.done++
+	if err == nil {
+		p.stored++
+	} else if len(p.errors) < maxSkipped {
+		p.errors = append(p.errors, err.Error())
+	} else {
+		p.dropped++
+	}
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
 
-	if len(qm.queue)-qm.position < 1 {
-		qm.cond.Wait()
+// PushTask: saves upload of list id in format taskType by actor and returns its ID, upload is decoded in turn.
+// Returns ErrBusy when there are too many uploads queued in total or by actor
+func (qm *queueManager) PushTask(ctx context.Context, id, taskType, actor string, body []byte) (string, error) {
+	if _, fd := qm.Workers[taskType]; !fd {
+		return "", fmt.Errorf("%w %s", ErrUnknownFormat, taskType)
 	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	upload := hex.EncodeToString(buf)
 
-	return qm.queue[qm.position]
+	qm.push.Lock()
+	defer qm.push.Unlock()
+	all, byActor, err := qm.storage.CountUploads(ctx, actor)
+	if err != nil {
+		return "", err
+	}
+	if qm.Options.MaxQueued > 0 && all >= qm.Options.MaxQueued {
+		return "", fmt.Errorf("%w, %d uploads are waiting, try again later", ErrBusy, all)
+	}
+	if qm.Options.MaxQueuedPerUser > 0 && byActor >= qm.Options.MaxQueuedPerUser {
+		return "", fmt.Errorf("%w, %s has %d uploads waiting, try again later", ErrBusy, actor, byActor)
+	}
+	if err = qm.storage.SaveUpload(ctx, upload, id, taskType, actor, body); err != nil {
+		return "", err
+	}
+	qm.notify()
+	return upload, nil
 }
 
-// PushTask: pushes new task with ID, type, name and byte body then wakes up wait routine
-func (qm *queueManager) PushTask(id string, taskType string, body []byte, name string) error {
-	go func() {
+// GetList: returns ID of a list upload belongs to
+func (qm *queueManager) GetList(ctx context.Context, id string) (string, error) {
+	body, err := qm.storage.GetUpload(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	var u upload
+	if err = json.Unmarshal(body, &u); err != nil {
+		return "", err
+	}
+	return u.List, nil
+}
+
+// GetJSON: returns upload as JSON, waits up to wait for it to finish. Upload that is running has rows
+// saved so far and errors of rows that weren't
+func (qm *queueManager) GetJSON(ctx context.Context, id string, wait time.Duration) ([]byte, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
 		qm.mtx.Lock()
-		defer qm.mtx.Unlock()
+		changed := qm.changed
+		qm.mtx.Unlock()
 
-		worker, fd := qm.Workers[taskType]
-		if !fd {
-			log.Println(errors.New("data is in unknown format"))
-			return
-		}
-		file, err := os.Create(path.Join(qm.Options.Prefix, name))
+		body, err := qm.storage.GetUpload(ctx, id)
 		if err != nil {
-			log.Println(err.Error())
-			return
+			return nil, err
 		}
-		_, err = file.Write(body)
-		if err != nil {
-			log.Println(err.Error())
-			return
+		var u struct {
+			Status string `json:"status"`
+		}
+		if err = json.Unmarshal(body, &u); err != nil {
+			return nil, err
 		}
-		file.Close()
+		if wait <= 0 || u.Status == StatusSucceeded || u.Status == StatusFailed {
+			if u.Status == StatusRunning {
+				return qm.withProgress(id, body)
+			}
+			return body, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			wait = 0
+		case <-ctx.Done():
+			return qm.withProgress(id, body)
+		}
+	}
+}
 
-		qm.queue = append(qm.queue, task{id: id, file: name, do: worker})
-		qm.cond.Signal()
-	}()
-	return nil
+// withProgress: adds rows of a running upload that were saved so far and errors of rows that weren't to its JSON
+func (qm *queueManager) withProgress(id string, body []byte) ([]byte, error) {
+	qm.mtx.Lock()
+	p, fd := qm.running[id]
+	var stored int
+	var failed []string
+	if fd {
+		stored, failed = p.stored, append([]string{}, p.errors...)
+	}
+	qm.mtx.Unlock()
+	if !fd {
+		return body, nil
+	}
+	var u map[string]interface{}
+	if err := json.Unmarshal(body, &u); err != nil {
+		return nil, err
+	}
+	if status, _ := u["status"].(string); status != StatusRunning {
+		return body, nil
+	}
+	u["rows"], u["errors"] = stored, failed
+	return json.Marshal(u)
 }
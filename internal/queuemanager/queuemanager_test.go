@@ -0,0 +1,314 @@
+package queuemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUpload struct {
+	upload
+	Status  string   `json:"status"`
+	Rows    int      `json:"rows"`
+	Skipped []string `json:"errors"`
+}
+
+type testStorage struct {
+	mtx     sync.Mutex
+	uploads []*testUpload
+}
+
+func (st *testStorage) SaveUpload(ctx context.Context, id, list, format, actor string, body []byte) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	st.uploads = append(st.uploads, &testUpload{upload: upload{ID: id, List: list, Format: format, Actor: actor, Body: body},
+		Status: StatusQueued})
+	return nil
+}
+
+func (st *testStorage) CountUploads(ctx context.Context, actor string) (int, int, error) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	var all, byActor int
+	for _, u := range st.uploads {
+		if u.Status == StatusQueued || u.Status == StatusRunning {
+			all++
+			if u.Actor == actor {
+				byActor++
+			}
+		}
+	}
+	return all, byActor, nil
+}
+
+func (st *testStorage) NextUpload(ctx context.Context, perActor int) ([]byte, error) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	running := make(map[string]int)
+	for _, u := range st.uploads {
+		if u.Status == StatusRunning {
+			running[u.Actor]++
+		}
+	}
+	for _, u := range st.uploads {
+		if u.Status == StatusQueued && running[u.Actor] < perActor {
+			u.Status = StatusRunning
+			return json.Marshal(u.upload)
+		}
+	}
+	return nil, nil
+}
+
+func (st *testStorage) FinishUpload(ctx context.Context, id, status string, rows int, skipped []string) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	for _, u := range st.uploads {
+		if u.ID == id {
+			u.Status, u.Rows, u.Skipped = status, rows, skipped
+		}
+	}
+	return nil
+}
+
+func (st *testStorage) ResetUploads(ctx context.Context, before time.Time) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	for _, u := range st.uploads {
+		if u.Status == StatusRunning {
+			u.Status = StatusQueued
+		}
+	}
+	return nil
+}
+
+func (st *testStorage) GetUpload(ctx context.Context, id string) ([]byte, error) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	for _, u := range st.uploads {
+		if u.ID == id {
+			return json.Marshal(u)
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func Test_Upload(t *testing.T) {
+	storage := &testStorage{}
+	qm := New(nil, storage)
+	qm.Options = &Options{Workers: 1, PerUser: 1}
+	qm.Workers["csv"] = func(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error) {
+		body, err := io.ReadAll(data)
+		require.NoError(t, err)
+		if string(body) == "broken" {
+			return 0, nil, errors.New("unable to read csv")
+		}
+		//rows are saved after worker passes them on
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			qm.Stored(upload, nil)
+			qm.Stored(upload, nil)
+			qm.Stored(upload, errors.New("NE555: connection refused"))
+		}()
+		return 3, []string{"record on line 3: wrong number of fields"}, nil
+	}
+
+	_, err := qm.PushTask(context.Background(), "list", "xlsx", "someone@example.com", nil)
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	ok, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", []byte("part name\nTL072"))
+	require.NoError(t, err)
+	broken, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", []byte("broken"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, qm.Start(ctx))
+
+	list, err := qm.GetList(context.Background(), ok)
+	require.NoError(t, err)
+	assert.Equal(t, "list", list)
+
+	var u testUpload
+	body, err := qm.GetJSON(context.Background(), broken, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &u))
+	assert.Equal(t, StatusFailed, u.Status)
+	assert.Equal(t, []string{"unable to read csv"}, u.Skipped)
+
+	body, err = qm.GetJSON(context.Background(), ok, 0)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &u))
+	assert.Equal(t, StatusSucceeded, u.Status)
+	assert.Equal(t, 2, u.Rows, "only saved rows should be counted")
+	assert.Equal(t, []string{"record on line 3: wrong number of fields", "NE555: connection refused"}, u.Skipped)
+}
+
+func Test_Limits(t *testing.T) {
+	storage := &testStorage{}
+	qm := New(nil, storage)
+	qm.Options = &Options{Workers: 3, PerUser: 1, MaxQueued: 4, MaxQueuedPerUser: 3}
+
+	var mtx sync.Mutex
+	running := make(map[string]int)
+	var maxRunning int
+	release := make(chan struct{})
+	qm.Workers["csv"] = func(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error) {
+		mtx.Lock()
+		running[actor]++
+		if running[actor] > maxRunning {
+			maxRunning = running[actor]
+		}
+		mtx.Unlock()
+		<-release
+		mtx.Lock()
+		running[actor]--
+		mtx.Unlock()
+		qm.Stored(upload, nil)
+		return 1, nil, nil
+	}
+
+	var pushed []string
+	for i := 0; i < 3; i++ {
+		id, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", nil)
+		require.NoError(t, err)
+		pushed = append(pushed, id)
+	}
+	_, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", nil)
+	assert.ErrorIs(t, err, ErrBusy, "user shouldn't queue more uploads than allowed")
+	id, err := qm.PushTask(context.Background(), "list", "csv", "another@example.com", nil)
+	require.NoError(t, err)
+	pushed = append(pushed, id)
+	_, err = qm.PushTask(context.Background(), "list", "csv", "third@example.com", nil)
+	assert.ErrorIs(t, err, ErrBusy, "queue shouldn't take more uploads than allowed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, qm.Start(ctx))
+	close(release)
+
+	for _, id := range pushed {
+		var u testUpload
+		body, err := qm.GetJSON(context.Background(), id, time.Second)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &u))
+		assert.Equal(t, StatusSucceeded, u.Status)
+	}
+	assert.Equal(t, 1, maxRunning, "uploads of one user should be decoded one at a time")
+}
+
+func Test_Shutdown(t *testing.T) {
+	storage := &testStorage{}
+	qm := New(nil, storage)
+	qm.Options = &Options{Workers: 2, PerUser: 1}
+	started := make(chan struct{})
+	qm.Workers["csv"] = func(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error) {
+		if actor == "slow@example.com" {
+			close(started)
+			<-ctx.Done()
+			return 0, nil, ctx.Err()
+		}
+		qm.Stored(upload, nil)
+		return 1, nil, nil
+	}
+	slow, err := qm.PushTask(context.Background(), "list", "csv", "slow@example.com", nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, qm.Start(ctx))
+	<-started
+	cancel()
+	queued, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", nil)
+	require.NoError(t, err)
+
+	deadline, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	assert.ErrorIs(t, qm.Shutdown(deadline), context.DeadlineExceeded)
+
+	for id, status := range map[string]string{slow: StatusRunning, queued: StatusQueued} {
+		var u testUpload
+		body, err := qm.GetJSON(context.Background(), id, 0)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &u))
+		assert.Equal(t, status, u.Status, "upload should be decoded after restart")
+	}
+}
+
+func Test_Lost(t *testing.T) {
+	storage := &testStorage{}
+	qm := New(nil, storage)
+	qm.Options = &Options{Workers: 1, PerUser: 1}
+	flushed := make(chan struct{}, 1)
+	qm.Flush = func() {
+		select {
+		case flushed <- struct{}{}:
+		default:
+		}
+	}
+	var upload string
+	qm.Workers["csv"] = func(ctx context.Context, id, list, actor string, data io.Reader) (int, []string, error) {
+		upload = id
+		return 2, nil, nil
+	}
+	id, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, qm.Start(ctx))
+
+	<-flushed
+	var u testUpload
+	body, err := qm.GetJSON(context.Background(), id, 20*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &u))
+	assert.Equal(t, StatusRunning, u.Status, "upload shouldn't finish before its rows are saved")
+
+	qm.Stored(upload, errors.New("TL072: connection refused"))
+	qm.Stored(upload, errors.New("NE555: connection refused"))
+	body, err = qm.GetJSON(context.Background(), id, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &u))
+	assert.Equal(t, StatusFailed, u.Status, "upload without saved rows should fail")
+	assert.Equal(t, 0, u.Rows)
+	assert.Len(t, u.Skipped, 2)
+}
+
+func Test_Progress(t *testing.T) {
+	storage := &testStorage{}
+	qm := New(nil, storage)
+	qm.Options = &Options{Workers: 1, PerUser: 1}
+	passed := make(chan string, 1)
+	qm.Workers["csv"] = func(ctx context.Context, upload, id, actor string, data io.Reader) (int, []string, error) {
+		passed <- upload
+		return 3, nil, nil
+	}
+	id, err := qm.PushTask(context.Background(), "list", "csv", "someone@example.com", nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, qm.Start(ctx))
+
+	upload := <-passed
+	qm.Stored(upload, nil)
+	qm.Stored(upload, errors.New("NE555: connection refused"))
+	var u testUpload
+	body, err := qm.GetJSON(context.Background(), id, 0)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &u))
+	assert.Equal(t, StatusRunning, u.Status)
+	assert.Equal(t, 1, u.Rows, "rows saved so far should be shown while upload runs")
+	assert.Equal(t, []string{"NE555: connection refused"}, u.Skipped)
+
+	qm.Stored(upload, nil)
+	body, err = qm.GetJSON(context.Background(), id, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &u))
+	assert.Equal(t, StatusSucceeded, u.Status)
+	assert.Equal(t, 2, u.Rows)
+}
@@ -0,0 +1,167 @@
+package regions
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Region: region of EFind, regions without parent are countries or parts of the world
+type Region struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Parent   string    `json:"parent,omitempty"`
+	Children []*Region `json:"children,omitempty"`
+}
+
+type regions struct {
+	mtx     sync.RWMutex
+	byID    map[string]*Region
+	byName  map[string][]*Region
+	roots   []*Region
+	Options *Options
+}
+
+type Options struct {
+	Filepath string
+}
+
+// Errors returned by regions
+var (
+	ErrNotFound  = errors.New("no such region")
+	ErrAmbiguous = errors.New("several regions have this name, use region ID")
+)
+
+// New: returns empty region tree, Init loads it from file
+func New() *regions {
+	return &regions{byID: make(map[string]*Region), byName: make(map[string][]*Region)}
+}
+
+// Init: loads region tree from markdown table with region name, ID and parent ID columns
+func (r *regions) Init() error {
+	file, err := os.Open(r.Options.Filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	byID := make(map[string]*Region)
+	byName := make(map[string][]*Region)
+	var ordered []*Region
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "|"), "|")
+		columns := strings.Split(line, "|")
+		if len(columns) < 3 {
+			continue
+		}
+		region := &Region{Name: strings.TrimSpace(columns[0]), ID: strings.TrimSpace(columns[1]), Parent: strings.TrimSpace(columns[2])}
+		if _, err := strconv.Atoi(region.ID); err != nil {
+			//header of a table
+			continue
+		}
+		if _, fd := byID[region.ID]; fd {
+			return fmt.Errorf("region %s is in %s twice", region.ID, r.Options.Filepath)
+		}
+		byID[region.ID] = region
+		key := strings.ToLower(region.Name)
+		byName[key] = append(byName[key], region)
+		ordered = append(ordered, region)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	var roots []*Region
+	for _, region := range ordered {
+		if region.Parent == "" {
+			roots = append(roots, region)
+			continue
+		}
+		parent, fd := byID[region.Parent]
+		if !fd {
+			return fmt.Errorf("parent %s of region %s isn't in %s", region.Parent, region.ID, r.Options.Filepath)
+		}
+		parent.Children = append(parent.Children, region)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.byID, r.byName, r.roots = byID, byName, roots
+	return nil
+}
+
+// Lookup: returns ID of a region by its ID or name, names are case insensitive
+func (r *regions) Lookup(key string) (string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	key = strings.TrimSpace(key)
+	if region, fd := r.byID[key]; fd {
+		return region.ID, nil
+	}
+	found := r.byName[strings.ToLower(key)]
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%w %q", ErrNotFound, key)
+	case 1:
+		return found[0].ID, nil
+	}
+	ids := make([]string, len(found))
+	for i, region := range found {
+		ids[i] = region.ID
+	}
+	return "", fmt.Errorf("%w: %q is %s", ErrAmbiguous, key, strings.Join(ids, ", "))
+}
+
+// Name: returns name of a region with ID
+func (r *regions) Name(id string) (string, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	region, fd := r.byID[id]
+	if !fd {
+		return "", fmt.Errorf("%w %q", ErrNotFound, id)
+	}
+	return region.Name, nil
+}
+
+// Parent: returns ID of region one level higher, empty string if region is a country or isn't known
+func (r *regions) Parent(id string) string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if region, fd := r.byID[id]; fd {
+		return region.Parent
+	}
+	return ""
+}
+
+// Children: returns IDs of regions one level lower
+func (r *regions) Children(id string) []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	region, fd := r.byID[id]
+	if !fd {
+		return nil
+	}
+	output := make([]string, len(region.Children))
+	for i, child := range region.Children {
+		output[i] = child.ID
+	}
+	return output
+}
+
+// GetJSON: returns region tree in JSON format, countries go first and every region has its children
+func (r *regions) GetJSON() ([]byte, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return json.Marshal(r.roots)
+}
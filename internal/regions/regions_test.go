@@ -0,0 +1,72 @@
+package regions
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegions(t *testing.T, table string) *regions {
+	filepath := path.Join(t.TempDir(), "regions.md")
+	require.NoError(t, os.WriteFile(filepath, []byte(table), 0o600))
+	r := New()
+	r.Options = &Options{Filepath: filepath}
+	return r
+}
+
+func Test_Regions(t *testing.T) {
+	r := newTestRegions(t, `|Регион|ID|Родитель|
+|:---:|:---:|:---:|
+|Россия|1||
+|Москва и Московская область|2|1|
+|Москва|3|2|
+|Beijing|1141|189|
+|Beijing|1142|189|
+|Китай|189||
+`)
+	require.NoError(t, r.Init())
+
+	id, err := r.Lookup("москва")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", id)
+
+	id, err = r.Lookup("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", id)
+
+	_, err = r.Lookup("Beijing")
+	assert.ErrorIs(t, err, ErrAmbiguous)
+
+	_, err = r.Lookup("Атлантида")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Equal(t, "2", r.Parent("3"))
+	assert.Equal(t, "", r.Parent("1"))
+	assert.Equal(t, []string{"1141", "1142"}, r.Children("189"))
+
+	name, err := r.Name("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Россия", name)
+}
+
+func Test_RegionsWithUnknownParent(t *testing.T) {
+	r := newTestRegions(t, `|Регион|ID|Родитель|
+|:---:|:---:|:---:|
+|Москва|3|2|
+`)
+	assert.Error(t, r.Init())
+}
+
+func Test_RegionsFile(t *testing.T) {
+	r := New()
+	r.Options = &Options{Filepath: "../../regions.md"}
+	require.NoError(t, r.Init(), "every parent in regions.md should be a region too")
+	for id := "3"; id != ""; id = r.Parent(id) {
+		if r.Parent(id) == "" {
+			assert.Equal(t, "1", id, "Moscow should be in Russia")
+		}
+	}
+}
@@ -4,17 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"math/rand"
 	"time"
+)
 
-	"github.com/icyrogue/ye-keeper/internal/jsonmodels"
+// Errors returned by request processor
+var (
+	ErrInvalidComponent = errors.New("invalid component")
 )
 
 type Storage interface {
 	NewList(ctx context.Context, id string) (bool, error)
 	AddItem(ctx context.Context, args [][]interface{}) error
-	GetList(ctx context.Context, id string, pageNum, pageSize int) ([]byte, error)
+	GetList(ctx context.Context, id string, pageNum, pageSize int, all bool) ([]byte, error)
+	GetItem(ctx context.Context, id, itemID string) ([]byte, error)
+	GetItemID(ctx context.Context, id, name string) (string, error)
+	UpdateItem(ctx context.Context, id, itemID, name string, schema []byte, actor, source string) error
+	SetTracking(ctx context.Context, id, itemID string, tracking bool, actor, source string) error
+	DeleteItem(ctx context.Context, id, itemID, actor, source string) error
 }
 
 type SchemaManager interface {
@@ -29,11 +38,6 @@ type MultiEncoder interface {
 
 type Analyzer interface {
 	GetInput() chan []string
-	GetDeleteInput() chan []byte
-}
-
-type CacheManager interface {
-	Get(ctx context.Context, name string) chan []jsonmodels.JSONResponse
 }
 
 type requestProcessor struct {
@@ -41,12 +45,11 @@ type requestProcessor struct {
 	SchemaManager SchemaManager
 	multiEncoder  MultiEncoder
 	analyzer      Analyzer
-	cacheManager  CacheManager
 }
 
-func New(st Storage, schemaManager SchemaManager, multiEncoder MultiEncoder, analyzer Analyzer, cacheManager CacheManager) *requestProcessor {
+func New(st Storage, schemaManager SchemaManager, multiEncoder MultiEncoder, analyzer Analyzer) *requestProcessor {
 	return &requestProcessor{st: st, SchemaManager: schemaManager,
-		multiEncoder: multiEncoder, analyzer: analyzer, cacheManager: cacheManager}
+		multiEncoder: multiEncoder, analyzer: analyzer}
 }
 
 // Get a seed so that ids are random every time
@@ -79,13 +82,16 @@ func (p *requestProcessor) GenList(ctx context.Context) (string, error) {
 	return id, nil
 }
 
-// Add item: adds single item to db
-func (p *requestProcessor) AddItem(ctx context.Context, id string, data map[string]string) error {
+// Add item: adds single item to db, actor is whoever added it
+func (p *requestProcessor) AddItem(ctx context.Context, id, actor string, data map[string]string) error {
 	var names []string
-	args := make([]interface{}, 4)
+	args := make([]interface{}, 6)
 	for key := range data {
 		names = append(names, key)
 	}
+	if _, fd := data["part name"]; !fd {
+		return fmt.Errorf("%w: component has no field \"part name\"", ErrInvalidComponent)
+	}
 	_, err := p.SchemaManager.CompareFieldNames(id, names)
 	if err != nil {
 		return err
@@ -102,15 +108,17 @@ func (p *requestProcessor) AddItem(ctx context.Context, id string, data map[stri
 	args[1] = data["part name"] //component name
 	args[2] = body              //component record itself along with params
 	args[3] = true              //tracking: TRUE means that component should be tracked
+	args[4] = actor             //who added the component
+	args[5] = "single"          //how component was added
 	log.Println("adding items to storage")
 	err = p.st.AddItem(ctx, [][]interface{}{args})
 	return err
 }
 
-// Get list: returns list as JSON array of components
-func (p *requestProcessor) GetList(ctx context.Context, id string, pageNum, pageSize int) ([]byte, error) {
+// Get list: returns list as JSON array of components, untracked ones are included only if all is true
+func (p *requestProcessor) GetList(ctx context.Context, id string, pageNum, pageSize int, all bool) ([]byte, error) {
 	log.Println("got req for a list", id, pageNum, pageSize)
-	data, err := p.st.GetList(ctx, id, pageNum, pageSize)
+	data, err := p.st.GetList(ctx, id, pageNum, pageSize, all)
 	if err != nil {
 		log.Println(err.Error())
 		return nil, err
@@ -123,19 +131,72 @@ func (p *requestProcessor) GetList(ctx context.Context, id string, pageNum, page
 	return data, nil
 }
 
-// HandleDelete: passes delete req to worker
-func (p *requestProcessor) HandleDelete(id string, data []byte) error {
-	p.analyzer.GetDeleteInput() <- append(data, []byte(id)...)
-	return nil
+// HandleDelete: stops tracking an item given by its ID in field "item",
+// components without it are looked up by part name
+func (p *requestProcessor) HandleDelete(ctx context.Context, id, actor string, data []byte) error {
+	component := make(map[string]string)
+	if err := json.Unmarshal(data, &component); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidComponent, err.Error())
+	}
+	itemID := component["item"]
+	if itemID == "" {
+		if component["part name"] == "" {
+			return fmt.Errorf("%w: component has neither \"item\" nor \"part name\" field", ErrInvalidComponent)
+		}
+		var err error
+		if itemID, err = p.st.GetItemID(ctx, id, component["part name"]); err != nil {
+			return err
+		}
+	}
+	return p.st.SetTracking(ctx, id, itemID, false, actor, "untrack")
 }
 
-func (p *requestProcessor) GetCached(ctx context.Context, name string) (data []byte, err error) {
-	v, ok := <-p.cacheManager.Get(ctx, name)
-	if !ok {
-		return nil, errors.New("couldn't get information about component " + name + " after 10 tries")
+// EditItem: changes fields of an item component record, fields that aren't given stay the same
+func (p *requestProcessor) EditItem(ctx context.Context, id, itemID, actor string, fields map[string]string) error {
+	body, err := p.st.GetItem(ctx, id, itemID)
+	if err != nil {
+		return err
 	}
-	if data, err = json.Marshal(&v); err != nil {
-		return nil, err
+	var record struct {
+		Component map[string]string `json:"component"`
 	}
-	return data, nil
+	if err = json.Unmarshal(body, &record); err != nil {
+		return err
+	}
+	if record.Component == nil {
+		record.Component = make(map[string]string)
+	}
+	for key, value := range fields {
+		record.Component[key] = value
+	}
+	if record.Component["part name"] == "" {
+		return fmt.Errorf("%w: component has no field \"part name\"", ErrInvalidComponent)
+	}
+
+	var names []string
+	for key := range record.Component {
+		names = append(names, key)
+	}
+	if _, err = p.SchemaManager.CompareFieldNames(id, names); err != nil {
+		return err
+	}
+	params, err := p.SchemaManager.GetParams(id)
+	if err != nil {
+		return err
+	}
+	body, err = p.multiEncoder.EncodeJSON(record.Component, params)
+	if err != nil {
+		return err
+	}
+	return p.st.UpdateItem(ctx, id, itemID, record.Component["part name"], body, actor, "edit")
+}
+
+// Track: starts or stops tracking of an item
+func (p *requestProcessor) Track(ctx context.Context, id, itemID, actor string, tracking bool) error {
+	return p.st.SetTracking(ctx, id, itemID, tracking, actor, "track")
+}
+
+// DeleteItem: removes an item from a list for good
+func (p *requestProcessor) DeleteItem(ctx context.Context, id, itemID, actor string) error {
+	return p.st.DeleteItem(ctx, id, itemID, actor, "delete")
 }
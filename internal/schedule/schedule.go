@@ -0,0 +1,260 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	//time zones of quiet windows have to work without zoneinfo in the system
+	_ "time/tzdata"
+)
+
+// Schedule: when components of a list are checked, either every interval after the previous check
+// or at times of cron expression, checks that fall into quiet window are moved to its end
+type Schedule struct {
+	every time.Duration
+	month bool
+	cron  *cron
+	quiet *window
+}
+
+// window: time of day with no checks, from and to are minutes since midnight
+type window struct {
+	from     int
+	to       int
+	location *time.Location
+}
+
+// Errors returned by Parse
+var (
+	ErrInvalidInterval = errors.New("check interval should be hourly, daily, weekly, monthly or cron expression")
+	ErrInvalidQuiet    = errors.New("quiet window should look like 22:00-07:00 with optional time zone")
+)
+
+// intervals: named check intervals
+var intervals = map[string]time.Duration{
+	"hourly": time.Hour,
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// Parse: returns schedule for check interval and quiet window of a list schema. Components of a list
+// without interval are checked as often as quota allows. Cron expression is in UTC and so is
+// quiet window unless time zone is given
+func Parse(interval, quiet string) (*Schedule, error) {
+	s := &Schedule{}
+	interval = strings.TrimSpace(interval)
+	switch every, fd := intervals[strings.ToLower(interval)]; {
+	case interval == "":
+	case fd:
+		s.every = every
+	case strings.EqualFold(interval, "monthly"):
+		s.month = true
+	default:
+		c, err := parseCron(interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidInterval, err)
+		}
+		s.cron = c
+	}
+	if quiet = strings.TrimSpace(quiet); quiet != "" {
+		w, err := parseWindow(quiet)
+		if err != nil {
+			return nil, err
+		}
+		s.quiet = w
+	}
+	return s, nil
+}
+
+// Next: returns when component checked at last should be checked again
+func (s *Schedule) Next(last time.Time) time.Time {
+	next := last
+	switch {
+	case s.every != 0:
+		next = last.Add(s.every)
+	case s.month:
+		next = last.AddDate(0, 1, 0)
+	case s.cron != nil:
+		next = s.cron.next(last.UTC())
+	}
+	if s.quiet != nil {
+		next = s.quiet.after(next)
+	}
+	return next
+}
+
+// QuietUntil: returns when quiet window ends if t is inside of it
+func (s *Schedule) QuietUntil(t time.Time) (time.Time, bool) {
+	if s.quiet == nil {
+		return t, false
+	}
+	end := s.quiet.after(t)
+	return end, !end.Equal(t)
+}
+
+func parseWindow(quiet string) (*window, error) {
+	w := &window{location: time.UTC}
+	fields := strings.Fields(quiet)
+	if len(fields) > 2 {
+		return nil, ErrInvalidQuiet
+	}
+	if len(fields) == 2 {
+		location, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidQuiet, err)
+		}
+		w.location = location
+	}
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return nil, ErrInvalidQuiet
+	}
+	for i, bound := range bounds {
+		t, err := time.Parse("15:04", bound)
+		if err != nil {
+			return nil, ErrInvalidQuiet
+		}
+		minutes := t.Hour()*60 + t.Minute()
+		if i == 0 {
+			w.from = minutes
+		} else {
+			w.to = minutes
+		}
+	}
+	if w.from == w.to {
+		return nil, ErrInvalidQuiet
+	}
+	return w, nil
+}
+
+// after: returns t or the end of quiet window if t is inside of it, window can go over midnight
+func (w *window) after(t time.Time) time.Time {
+	local := t.In(w.location)
+	minutes := local.Hour()*60 + local.Minute()
+	var inside bool
+	if w.from < w.to {
+		inside = minutes >= w.from && minutes < w.to
+	} else {
+		inside = minutes >= w.from || minutes < w.to
+	}
+	if !inside {
+		return t
+	}
+	end := time.Date(local.Year(), local.Month(), local.Day(), w.to/60, w.to%60, 0, 0, w.location)
+	if minutes >= w.to {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// cron: parsed cron expression with minute, hour, day of month, month and day of week fields
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	anyDom, anyDow                bool
+}
+
+// cronFields: bounds of cron expression fields
+var cronFields = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func parseCron(expr string) (*cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression should have %d fields", len(cronFields))
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i][0], cronFields[i][1])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	//sunday can be written as 7 too
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cron{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		anyDom: fields[2] == "*", anyDow: fields[4] == "*"}, nil
+}
+
+// parseCronField: returns set of values as bits, field is a list of values, ranges and steps such as 1-5,*/15.
+// Value with step such as 5/15 starts at the value and goes up to max
+func parseCronField(field string, min, max int) (uint64, error) {
+	if max == 6 {
+		max = 7
+	}
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i != -1 {
+			stepped = true
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("incorrect step in %s", part)
+			}
+			part = part[:i]
+		}
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("incorrect value %s", part)
+			}
+			to = from
+			if stepped {
+				to = max
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("incorrect value %s", part)
+				}
+			}
+			if from < min || to > max || from > to {
+				return 0, fmt.Errorf("%s is out of range %d-%d", part, min, max)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// next: returns the first time after t that matches expression, searches for five years at most
+func (c *cron) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return limit
+}
+
+// day: reports whether day matches, day of month or day of week has to match if both are restricted
+func (c *cron) day(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Next(t *testing.T) {
+	last := time.Date(2022, 11, 20, 12, 30, 0, 0, time.UTC) //sunday
+	tests := []struct {
+		interval string
+		quiet    string
+		want     time.Time
+	}{
+		{"", "", last},
+		{"hourly", "", last.Add(time.Hour)},
+		{"Daily", "", last.Add(24 * time.Hour)},
+		{"monthly", "", time.Date(2022, 12, 20, 12, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1", "", time.Date(2022, 11, 21, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", "", time.Date(2022, 11, 20, 12, 45, 0, 0, time.UTC)},
+		{"5/15 * * * *", "", time.Date(2022, 11, 20, 12, 35, 0, 0, time.UTC)},
+		{"0 0 1 * *", "", time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", "", time.Date(2022, 11, 27, 8, 0, 0, 0, time.UTC)},
+		{"hourly", "13:00-14:00", time.Date(2022, 11, 20, 14, 0, 0, 0, time.UTC)},
+		{"daily", "22:00-13:00", time.Date(2022, 11, 21, 13, 0, 0, 0, time.UTC)},
+		{"", "12:00-16:00 Europe/Moscow", time.Date(2022, 11, 20, 16, 0, 0, 0, time.FixedZone("MSK", 3*60*60))},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.interval, tt.quiet)
+		require.NoError(t, err, tt.interval)
+		assert.True(t, tt.want.Equal(s.Next(last)), "%s %s: want %s, got %s", tt.interval, tt.quiet, tt.want, s.Next(last))
+	}
+}
+
+func Test_QuietUntil(t *testing.T) {
+	s, err := Parse("", "22:00-07:00")
+	require.NoError(t, err)
+	end, quiet := s.QuietUntil(time.Date(2022, 11, 20, 23, 0, 0, 0, time.UTC))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2022, 11, 21, 7, 0, 0, 0, time.UTC), end)
+	_, quiet = s.QuietUntil(time.Date(2022, 11, 20, 12, 0, 0, 0, time.UTC))
+	assert.False(t, quiet)
+}
+
+func Test_ParseErrors(t *testing.T) {
+	for _, interval := range []string{"yearly", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := Parse(interval, "")
+		assert.ErrorIs(t, err, ErrInvalidInterval, interval)
+	}
+	for _, quiet := range []string{"22:00", "25:00-07:00", "22:00-22:00", "22:00-07:00 Nowhere/City"} {
+		_, err := Parse("", quiet)
+		assert.ErrorIs(t, err, ErrInvalidQuiet, quiet)
+	}
+}
@@ -0,0 +1,403 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type scheduler struct {
+	mtx      sync.Mutex
+	storage  Storage
+	lanes    [2][]task
+	queued   map[key]int
+	retries  []retry
+	wake     chan struct{}
+	stopped  chan struct{}
+	tokens   float64
+	refilled time.Time
+	stats    stats
+	Options  *Options
+}
+
+type Options struct {
+	Quota       int
+	Period      time.Duration
+	Burst       int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+type Storage interface {
+	SaveRetry(ctx context.Context, id, name string, payload []byte, attempts int, due time.Time, reason string) error
+	DeleteRetry(ctx context.Context, id, name string) error
+	GetRetries(ctx context.Context) ([]byte, error)
+}
+
+// Handler: checks component name of list id and returns result of a check, payload is what component was pushed with
+type Handler func(ctx context.Context, id, name string, payload []byte) (string, error)
+
+// Report: gets result of every attempt to check a component, retry is true if it will be attempted again
+type Report func(id, name string, payload []byte, result string, err error, retry bool)
+
+type key struct {
+	id   string
+	name string
+}
+
+type task struct {
+	key
+	payload []byte
+	saved   bool
+}
+
+// retry: task that failed with temporary error and waits for its turn, saved in storage
+// so retries survive restarts
+type retry struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Due      time.Time       `json:"due"`
+}
+
+type stats struct {
+	used    int
+	waited  time.Duration
+	limited int
+	done    int
+	retried int
+	dropped int
+	failed  int
+}
+
+// Lanes of tasks, priority lane is emptied before normal one
+const (
+	lanePriority = iota
+	laneNormal
+)
+
+func New(storage Storage) *scheduler {
+	return &scheduler{storage: storage, queued: make(map[key]int), wake: make(chan struct{}, 1)}
+}
+
+// Start: loads retries from storage and starts handling tasks one at a time. Tasks from priority lane go first,
+// then retries that are due and then tasks from normal lane. Result of every attempt is reported
+func (s *scheduler) Start(ctx context.Context, handle Handler, report Report) error {
+	if s.Options.Quota < 1 || s.Options.Period <= 0 {
+		return errors.New("scheduler: quota and its period should be positive")
+	}
+	if s.Options.Burst < 1 {
+		s.Options.Burst = 1
+	}
+	s.mtx.Lock()
+	s.tokens = float64(s.Options.Burst)
+	s.refilled = time.Now()
+	s.mtx.Unlock()
+
+	body, err := s.storage.GetRetries(ctx)
+	if err != nil {
+		return err
+	}
+	var retries []retry
+	if err = json.Unmarshal(body, &retries); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	for _, r := range retries {
+		s.queued[key{r.ID, r.Name}]++
+		s.retries = append(s.retries, r)
+	}
+	s.sortRetries()
+	s.mtx.Unlock()
+	log.Println("scheduler loaded", len(retries), "retries")
+
+	s.stopped = make(chan struct{})
+	go func() {
+		defer close(s.stopped)
+		for {
+			t, attempts, ok := s.next(ctx)
+			if !ok {
+				return
+			}
+			result, err := handle(ctx, t.id, t.name, t.payload)
+			if err != nil && ctx.Err() != nil {
+				//check cut short by shutdown goes back to priority lane, so it is saved and made after restart
+				s.mtx.Lock()
+				s.lanes[lanePriority] = append([]task{t}, s.lanes[lanePriority]...)
+				s.mtx.Unlock()
+				return
+			}
+			report(t.id, t.name, t.payload, result, err, s.finish(ctx, t, attempts, err))
+		}
+	}()
+	return nil
+}
+
+// Push: adds component name of list id to priority or normal lane. Component that is already
+// queued, being checked or waits for retry isn't added to normal lane again, component added
+// to priority lane is taken out of normal one
+func (s *scheduler) Push(id, name string, payload []byte, priority bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{id, name}
+	lane := laneNormal
+	if priority {
+		lane = lanePriority
+		for i, t := range s.lanes[laneNormal] {
+			if t.key == k {
+				s.lanes[laneNormal] = append(s.lanes[laneNormal][:i], s.lanes[laneNormal][i+1:]...)
+				s.queued[k]--
+				break
+			}
+		}
+	} else if s.queued[k] != 0 {
+		return
+	}
+	s.queued[k]++
+	s.lanes[lane] = append(s.lanes[lane], task{key: k, payload: payload})
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len: returns number of tasks in lanes without retries
+func (s *scheduler) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.lanes[lanePriority]) + len(s.lanes[laneNormal])
+}
+
+// next: waits for the next task, attempts is number of times it failed before. Returns false when ctx is done
+func (s *scheduler) next(ctx context.Context) (task, int, bool) {
+	for {
+		if ctx.Err() != nil {
+			return task{}, 0, false
+		}
+		s.mtx.Lock()
+		now := time.Now()
+		switch {
+		case len(s.lanes[lanePriority]) != 0:
+			t := s.lanes[lanePriority][0]
+			s.lanes[lanePriority] = s.lanes[lanePriority][1:]
+			s.mtx.Unlock()
+			return t, 0, true
+		case len(s.retries) != 0 && !s.retries[0].Due.After(now):
+			r := s.retries[0]
+			s.retries = s.retries[1:]
+			s.mtx.Unlock()
+			return task{key: key{r.ID, r.Name}, payload: r.Payload, saved: true}, r.Attempts, true
+		case len(s.lanes[laneNormal]) != 0:
+			t := s.lanes[laneNormal][0]
+			s.lanes[laneNormal] = s.lanes[laneNormal][1:]
+			s.mtx.Unlock()
+			return t, 0, true
+		}
+		var due <-chan time.Time
+		var timer *time.Timer
+		if len(s.retries) != 0 {
+			timer = time.NewTimer(s.retries[0].Due.Sub(now))
+			due = timer.C
+		}
+		s.mtx.Unlock()
+		select {
+		case <-ctx.Done():
+			return task{}, 0, false
+		case <-s.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// finish: saves task for retry with exponential backoff if it failed with temporary error and reports
+// whether it will be retried, task is dropped after MaxAttempts attempts
+func (s *scheduler) finish(ctx context.Context, t task, attempts int, err error) bool {
+	if err == nil || !temporary(err) || attempts+1 >= s.Options.MaxAttempts {
+		s.mtx.Lock()
+		if s.queued[t.key]--; s.queued[t.key] <= 0 {
+			delete(s.queued, t.key)
+		}
+		switch {
+		case err == nil:
+			s.stats.done++
+		case temporary(err):
+			s.stats.dropped++
+			log.Println("scheduler dropped", t.name, "in list", t.id, "after", attempts+1, "attempts:", err.Error())
+		default:
+			s.stats.failed++
+			log.Println("scheduler failed to check", t.name, "in list", t.id, err.Error())
+		}
+		s.mtx.Unlock()
+		if t.saved {
+			if err := s.storage.DeleteRetry(ctx, t.id, t.name); err != nil {
+				log.Println(err.Error())
+			}
+		}
+		return false
+	}
+	attempts++
+	r := retry{ID: t.id, Name: t.name, Payload: t.payload, Attempts: attempts, Due: time.Now().Add(s.backoff(attempts))}
+	log.Println("scheduler retries", t.name, "in list", t.id, "at", r.Due.Format(time.RFC3339), err.Error())
+	if err := s.storage.SaveRetry(ctx, r.ID, r.Name, r.Payload, r.Attempts, r.Due, err.Error()); err != nil {
+		log.Println(err.Error())
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.stats.retried++
+	s.retries = append(s.retries, r)
+	s.sortRetries()
+	return true
+}
+
+// Shutdown: waits for the check that is being made when ctx given to Start is done and saves tasks
+// from priority lane as retries, so checks requested through API and checks that were cut short are made after restart
+func (s *scheduler) Shutdown(ctx context.Context) error {
+	if s.stopped != nil {
+		select {
+		case <-s.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mtx.Lock()
+	lane := s.lanes[lanePriority]
+	s.lanes[lanePriority] = nil
+	s.mtx.Unlock()
+	now := time.Now()
+	for _, t := range lane {
+		if err := s.storage.SaveRetry(ctx, t.id, t.name, t.payload, 0, now, "keeper stopped"); err != nil {
+			return err
+		}
+	}
+	log.Println("scheduler saved", len(lane), "checks for after restart")
+	return nil
+}
+
+// backoff: returns how long to wait before attempt, it doubles with every attempt up to MaxBackoff
+func (s *scheduler) backoff(attempts int) time.Duration {
+	wait := s.Options.MinBackoff
+	for i := 1; i < attempts && wait < s.Options.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > s.Options.MaxBackoff {
+		wait = s.Options.MaxBackoff
+	}
+	return wait
+}
+
+func (s *scheduler) sortRetries() {
+	sort.SliceStable(s.retries, func(i, j int) bool { return s.retries[i].Due.Before(s.retries[j].Due) })
+}
+
+// temporary: reports whether error may go away if task is retried later, such as rate limit or unavailable supplier
+func temporary(err error) bool {
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// Wait: takes a token from the bucket for one request to a supplier, blocks until there is one.
+// Bucket holds up to Burst tokens and gets Quota tokens every Period
+func (s *scheduler) Wait(ctx context.Context) error {
+	for {
+		s.mtx.Lock()
+		s.refill(time.Now())
+		if s.tokens >= 1 {
+			s.tokens--
+			s.stats.used++
+			s.mtx.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - s.tokens) * float64(s.interval()))
+		if start := time.Until(s.refilled); start > 0 {
+			wait += start
+		}
+		s.stats.waited += wait
+		s.mtx.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Limited: empties the bucket after supplier said quota is exceeded, no tokens
+// are added for MinBackoff
+func (s *scheduler) Limited() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.tokens = 0
+	s.refilled = time.Now().Add(s.Options.MinBackoff)
+	s.stats.limited++
+}
+
+// refill: adds tokens for time since the last refill, refill time can be in the future after Limited
+func (s *scheduler) refill(now time.Time) {
+	if !now.After(s.refilled) {
+		return
+	}
+	s.tokens += float64(now.Sub(s.refilled)) / float64(s.interval())
+	if s.tokens > float64(s.Options.Burst) {
+		s.tokens = float64(s.Options.Burst)
+	}
+	s.refilled = now
+}
+
+// interval: returns time it takes to get one token
+func (s *scheduler) interval() time.Duration {
+	return s.Options.Period / time.Duration(s.Options.Quota)
+}
+
+type metrics struct {
+	Quota  quotaMetrics `json:"quota"`
+	Queues queueMetrics `json:"queues"`
+	Checks checkMetrics `json:"checks"`
+}
+
+type quotaMetrics struct {
+	Quota     int     `json:"quota"`
+	Period    float64 `json:"period"`
+	Burst     int     `json:"burst"`
+	Available float64 `json:"available"`
+	Used      int     `json:"used"`
+	Waited    float64 `json:"waited"`
+	Limited   int     `json:"limited"`
+}
+
+type queueMetrics struct {
+	Priority int `json:"priority"`
+	Normal   int `json:"normal"`
+	Retry    int `json:"retry"`
+}
+
+type checkMetrics struct {
+	Done    int `json:"done"`
+	Retried int `json:"retried"`
+	Dropped int `json:"dropped"`
+	Failed  int `json:"failed"`
+}
+
+// GetJSON: returns quota usage and queue lengths as JSON, times are in seconds
+func (s *scheduler) GetJSON() ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.refill(time.Now())
+	return json.Marshal(metrics{
+		Quota: quotaMetrics{Quota: s.Options.Quota, Period: s.Options.Period.Seconds(), Burst: s.Options.Burst,
+			Available: s.tokens, Used: s.stats.used, Waited: s.stats.waited.Seconds(), Limited: s.stats.limited},
+		Queues: queueMetrics{Priority: len(s.lanes[lanePriority]), Normal: len(s.lanes[laneNormal]), Retry: len(s.retries)},
+		Checks: checkMetrics{Done: s.stats.done, Retried: s.stats.retried, Dropped: s.stats.dropped, Failed: s.stats.failed},
+	})
+}
@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStorage struct {
+	mtx     sync.Mutex
+	retries map[string]retry
+}
+
+func (st *testStorage) SaveRetry(ctx context.Context, id, name string, payload []byte, attempts int, due time.Time, reason string) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	st.retries[id+name] = retry{ID: id, Name: name, Payload: payload, Attempts: attempts, Due: due}
+	return nil
+}
+
+func (st *testStorage) DeleteRetry(ctx context.Context, id, name string) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	delete(st.retries, id+name)
+	return nil
+}
+
+func (st *testStorage) GetRetries(ctx context.Context) ([]byte, error) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	output := []retry{}
+	for _, r := range st.retries {
+		output = append(output, r)
+	}
+	return json.Marshal(output)
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "try later" }
+func (temporaryError) Temporary() bool { return true }
+
+func noReport(id, name string, payload []byte, result string, err error, retry bool) {}
+
+func newScheduler(storage Storage) *scheduler {
+	s := New(storage)
+	s.Options = &Options{Quota: 100, Period: time.Second, Burst: 1, MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond, MaxAttempts: 3}
+	return s
+}
+
+func Test_Lanes(t *testing.T) {
+	s := newScheduler(&testStorage{retries: map[string]retry{}})
+	s.Push("list", "normal", nil, false)
+	s.Push("list", "later", nil, false)
+	s.Push("list", "priority", nil, true)
+	s.Push("list", "normal", nil, false)
+	assert.Equal(t, 3, s.Len(), "queued component shouldn't be added again")
+	s.Push("list", "later", []byte("now"), true)
+	assert.Equal(t, 3, s.Len(), "component should be taken out of normal lane")
+
+	handled := make(chan string, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, s.Start(ctx, func(ctx context.Context, id, name string, payload []byte) (string, error) {
+		handled <- name + string(payload)
+		return "", nil
+	}, noReport))
+	assert.Equal(t, "priority", <-handled)
+	assert.Equal(t, "laternow", <-handled)
+	assert.Equal(t, "normal", <-handled)
+}
+
+func Test_Retry(t *testing.T) {
+	storage := &testStorage{retries: map[string]retry{}}
+	s := newScheduler(storage)
+	s.Push("list", "flaky", []byte(`{"amount": "1"}`), false)
+	s.Push("list", "broken", nil, false)
+
+	attempts := make(map[string]int)
+	var retries []bool
+	var mtx sync.Mutex
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, s.Start(ctx, func(ctx context.Context, id, name string, payload []byte) (string, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		attempts[name]++
+		switch {
+		case name == "broken":
+			return "", errors.New("not temporary")
+		case attempts[name] < 3:
+			assert.JSONEq(t, `{"amount": "1"}`, string(payload))
+			return "", temporaryError{}
+		}
+		return "available", nil
+	}, func(id, name string, payload []byte, result string, err error, retry bool) {
+		if name != "flaky" {
+			return
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		retries = append(retries, retry)
+		if result == "available" {
+			close(done)
+		}
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("component wasn't retried")
+	}
+	time.Sleep(10 * time.Millisecond)
+	mtx.Lock()
+	assert.Equal(t, map[string]int{"flaky": 3, "broken": 1}, attempts)
+	assert.Equal(t, []bool{true, true, false}, retries)
+	mtx.Unlock()
+	storage.mtx.Lock()
+	assert.Empty(t, storage.retries, "retry should be deleted after success")
+	storage.mtx.Unlock()
+
+	assert.Equal(t, 10*time.Millisecond, s.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, s.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, s.backoff(5))
+}
+
+func Test_Wait(t *testing.T) {
+	s := newScheduler(&testStorage{retries: map[string]retry{}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, s.Start(ctx, func(ctx context.Context, id, name string, payload []byte) (string, error) { return "", nil }, noReport))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.Wait(ctx))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond, "only one token should be there at once")
+
+	s.Limited()
+	start = time.Now()
+	require.NoError(t, s.Wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond, "tokens shouldn't be added for a while after limit")
+
+	var m metrics
+	body, err := s.GetJSON()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &m))
+	assert.Equal(t, 4, m.Quota.Used)
+	assert.Equal(t, 1, m.Quota.Limited)
+}
+
+func Test_Shutdown(t *testing.T) {
+	storage := &testStorage{retries: map[string]retry{}}
+	s := newScheduler(storage)
+	s.Push("list", "first", nil, true)
+	s.Push("list", "second", []byte(`{"job": "1"}`), true)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var checked []string
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, s.Start(ctx, func(ctx context.Context, id, name string, payload []byte) (string, error) {
+		checked = append(checked, name)
+		close(started)
+		<-release
+		return "available", nil
+	}, noReport))
+	<-started
+	cancel()
+	close(release)
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, []string{"first"}, checked, "check being made should be finished")
+	require.Contains(t, storage.retries, "listsecond", "queued check should be saved")
+	assert.JSONEq(t, `{"job": "1"}`, string(storage.retries["listsecond"].Payload))
+
+	restarted := newScheduler(storage)
+	done := make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, restarted.Start(ctx, func(ctx context.Context, id, name string, payload []byte) (string, error) {
+		assert.Equal(t, "second", name)
+		return "available", nil
+	}, func(id, name string, payload []byte, result string, err error, retry bool) {
+		close(done)
+	}))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("saved check wasn't made after restart")
+	}
+	time.Sleep(10 * time.Millisecond)
+	storage.mtx.Lock()
+	assert.Empty(t, storage.retries, "saved check should be deleted once it is made")
+	storage.mtx.Unlock()
+}
+
+func Test_ShutdownCancels(t *testing.T) {
+	storage := &testStorage{retries: map[string]retry{}}
+	s := newScheduler(storage)
+	s.Push("list", "slow", []byte(`{"job": "2"}`), false)
+
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, s.Start(ctx, func(ctx context.Context, id, name string, payload []byte) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, noReport))
+	<-started
+	cancel()
+	deadline, stop := context.WithTimeout(context.Background(), time.Second)
+	defer stop()
+	require.NoError(t, s.Shutdown(deadline), "check should stop once keeper stops")
+	require.Contains(t, storage.retries, "listslow", "check that was cut short should be saved")
+	assert.JSONEq(t, `{"job": "2"}`, string(storage.retries["listslow"].Payload))
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/icyrogue/ye-keeper/internal/schedule"
 )
 
 type schema struct {
@@ -17,13 +22,22 @@ type schema struct {
 	FieldsAsString string `json:"fieldNames"`
 	Region         string `json:"region"`
 	MinAmount      string `json:"minimumAmount"`
+	Suppliers      string `json:"suppliers,omitempty"`
+	AmountField    string `json:"amountField,omitempty"`
+	BuildQuantity  string `json:"buildQuantity,omitempty"`
+	CheckInterval  string `json:"checkInterval,omitempty"`
+	QuietWindow    string `json:"quietWindow,omitempty"`
+	MaxAge         string `json:"maxAge,omitempty"`
 }
 
 type schemaManager struct {
 	data    map[string]schema
 	mtx     sync.RWMutex
 	storage Storage
+	regions Regions
 	Options *Options
+	// Suppliers: names of suppliers schemas can list, any name is accepted if there are none
+	Suppliers []string
 }
 
 type Options struct {
@@ -36,13 +50,26 @@ const (
 	defaultMinAmaunt = "100"
 )
 
+// Errors returned by schema manager
+var (
+	ErrNoSchema      = errors.New("no schema for list with such ID")
+	ErrSchemaExists  = errors.New("schema for list with such ID already exists")
+	ErrNoNameField   = errors.New("wasnt able to determine name field position")
+	ErrInvalidSchema = errors.New("invalid schema")
+)
+
 type Storage interface {
 	SyncSchemas(ctx context.Context) ([]byte, error)
+	ResetChecks(ctx context.Context, id string) error
+}
+
+type Regions interface {
+	Lookup(key string) (string, error)
 }
 
 // New: returns new schema Manager
-func New(storage Storage) *schemaManager {
-	return &schemaManager{storage: storage, data: make(map[string]schema)}
+func New(storage Storage, regions Regions) *schemaManager {
+	return &schemaManager{storage: storage, regions: regions, data: make(map[string]schema)}
 }
 
 func (sm *schemaManager) Init() error {
@@ -74,7 +101,7 @@ func (sm *schemaManager) NewSchema(id string) error {
 	defer sm.mtx.Unlock()
 
 	if _, fd := sm.data[id]; fd {
-		return errors.New("schema for list with such ID already exists")
+		return ErrSchemaExists
 	}
 	sm.data[id] = schema{}
 	return nil
@@ -87,7 +114,7 @@ func (sm *schemaManager) GetSchemaJSON(id string) ([]byte, error) {
 
 	schema, fd := sm.data[id]
 	if !fd {
-		return nil, errors.New("no schema for list with such ID")
+		return nil, ErrNoSchema
 	}
 	log.Println(schema)
 
@@ -140,7 +167,7 @@ func (sm *schemaManager) GetNames(id string) (fields []string, position int, err
 
 	names, fd := sm.data[id]
 	if !fd {
-		return nil, 0, errors.New("no list with such ID")
+		return nil, 0, ErrNoSchema
 	}
 	if names.nameFieldPos == 0 {
 		for i, field := range names.fieldNames {
@@ -149,7 +176,7 @@ func (sm *schemaManager) GetNames(id string) (fields []string, position int, err
 				return names.fieldNames, names.nameFieldPos, nil
 			}
 		}
-		return nil, 0, errors.New("wasnt able to determine name field position")
+		return nil, 0, ErrNoNameField
 	}
 	return names.fieldNames, names.nameFieldPos, nil
 }
@@ -168,7 +195,7 @@ func (sm *schemaManager) GetParams(id string) (map[string]string, error) {
 	output := make(map[string]string)
 	schema, fd := sm.data[id]
 	if !fd {
-		return nil, errors.New("no schema with such ID")
+		return nil, ErrNoSchema
 	}
 
 	output["id"] = schema.ID
@@ -177,22 +204,79 @@ func (sm *schemaManager) GetParams(id string) (map[string]string, error) {
 	//	output["numField"] = schema.NumField
 	output["region"] = schema.Region
 	output["minimumAmount"] = schema.MinAmount
+	output["suppliers"] = schema.Suppliers
+	output["amountField"] = schema.AmountField
+	output["buildQuantity"] = schema.BuildQuantity
+	output["checkInterval"] = schema.CheckInterval
+	output["quietWindow"] = schema.QuietWindow
+	output["maxAge"] = schema.MaxAge
 	//	output["FieldsAsString"] = schema.FieldsAsString
 
 	return output, nil
 }
 
-// SaveSchemaJSON: saves new schema for ID
+// SaveSchemaJSON: saves new schema for ID, region can be given by its ID or name and is saved as ID.
+// Components of a list are rescheduled when check interval or quiet window changes
 func (sm *schemaManager) SaveSchemaJSON(id string, data []byte) error {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+
 	var component schema
-	_, fd := sm.data[id]
+	prev, fd := sm.data[id]
 	if !fd {
-		return errors.New("no schema for such ID")
+		return ErrNoSchema
 	}
 	err := json.Unmarshal(data, &component)
 	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+	if component.Region == "" {
+		component.Region = defaultRegion
+	}
+	if component.Region, err = sm.regions.Lookup(component.Region); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+	if component.BuildQuantity != "" {
+		if n, err := strconv.Atoi(component.BuildQuantity); err != nil || n < 1 {
+			return fmt.Errorf("%w: build quantity should be a positive number", ErrInvalidSchema)
+		}
+	}
+	if component.MaxAge != "" {
+		if d, err := time.ParseDuration(component.MaxAge); err != nil || d <= 0 {
+			return fmt.Errorf("%w: max age should be a positive duration such as 30m", ErrInvalidSchema)
+		}
+	}
+	if _, err = schedule.Parse(component.CheckInterval, component.QuietWindow); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+	if err = sm.checkSuppliers(component.Suppliers); err != nil {
 		return err
 	}
+	if component.CheckInterval != prev.CheckInterval || component.QuietWindow != prev.QuietWindow {
+		if err = sm.storage.ResetChecks(context.Background(), id); err != nil {
+			return err
+		}
+	}
 	sm.data[id] = component
 	return nil
 }
+
+// checkSuppliers: returns ErrInvalidSchema if comma separated suppliers have one keeper doesn't know
+func (sm *schemaManager) checkSuppliers(suppliers string) error {
+	if len(sm.Suppliers) == 0 {
+		return nil
+	}
+	for _, name := range strings.Split(suppliers, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		known := false
+		for _, supplier := range sm.Suppliers {
+			known = known || supplier == name
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown supplier %s, suppliers are %s", ErrInvalidSchema, name, strings.Join(sm.Suppliers, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package usermanager
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type apiKey struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Creator string    `json:"creator"`
+	Created time.Time `json:"created"`
+	Key     string    `json:"key,omitempty"`
+}
+
+// keyPrefix: API keys look like kk_{key ID}.{secret} so they can be told apart from jwt tokens
+const keyPrefix = "kk_"
+
+// NewKey: creates API key for a list with given scopes, returns key as JSON. Key itself is
+// only returned here, database keeps its hash
+func (u *userManager) NewKey(ctx context.Context, id, email, name string, scopes []string) ([]byte, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: API key needs at least one scope", ErrInvalidInput)
+	}
+	for _, scope := range scopes {
+		if _, fd := scopeRoles[scope]; !fd || scope == ScopeListAdmin {
+			return nil, fmt.Errorf("%w: scope %s can't be granted to API key", ErrInvalidInput, scope)
+		}
+	}
+	keyID, err := randomHex(4)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	key := apiKey{ID: keyID, Name: name, Scopes: scopes, Creator: email, Created: time.Now(),
+		Key: keyPrefix + keyID + "." + secret}
+	_, err = u.db.Exec(ctx, "INSERT INTO apikeys (keyid, id, name, hash, scopes, creator, created) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		key.ID, id, key.Name, hashCode(secret), key.Scopes, key.Creator, key.Created)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(key)
+}
+
+// GetKeys: returns every API key of a list as JSON array, without keys themselves
+func (u *userManager) GetKeys(ctx context.Context, id string) ([]byte, error) {
+	rows, err := u.db.Query(ctx, "SELECT keyid, name, scopes, creator, created FROM apikeys WHERE id = $1 ORDER BY created", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []apiKey{}
+	for rows.Next() {
+		var key apiKey
+		if err = rows.Scan(&key.ID, &key.Name, &key.Scopes, &key.Creator, &key.Created); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(keys)
+}
+
+// DeleteKey: revokes API key of a list
+func (u *userManager) DeleteKey(ctx context.Context, id, keyID string) error {
+	tag, err := u.db.Exec(ctx, "DELETE FROM apikeys WHERE id = $1 AND keyid = $2", id, keyID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: no API key with such ID", ErrNotFound)
+	}
+	return nil
+}
+
+// checkKey: checks that API key belongs to a list and has given scope, returns key ID
+func (u *userManager) checkKey(ctx context.Context, id, key, scope string) (string, error) {
+	keyID, secret, fd := strings.Cut(strings.TrimPrefix(key, keyPrefix), ".")
+	if !fd {
+		return "", ErrUnauthorized
+	}
+	var hash string
+	var scopes []string
+	err := u.db.QueryRow(ctx, "SELECT hash, scopes FROM apikeys WHERE keyid = $1 AND id = $2", keyID, id).Scan(&hash, &scopes)
+	if err != nil {
+		log.Println(err.Error())
+		return "", ErrUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashCode(secret))) != 1 {
+		return "", ErrUnauthorized
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return keyPrefix + keyID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: API key has no scope %s", ErrForbidden, scope)
+}
@@ -2,8 +2,16 @@ package usermanager
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/mail"
+	"strings"
+	"time"
 
 	//	"crypto/tls"
 	"errors"
@@ -20,19 +28,98 @@ type userManager struct {
 }
 
 type Options struct {
-	SecretKey string
+	SecretKey         string
+	TokenTTL          time.Duration
+	LoginCodesPerHour int
+	Admins            string
 }
 
+// Errors returned by user manager, other errors are internal ones
+var (
+	ErrUnauthorized    = errors.New("error while verifying user")
+	ErrForbidden       = errors.New("access denied")
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
 type NotificationManager interface {
 	Send(addr string, body []byte) error
 }
 
+type issuedToken struct {
+	ID      string    `json:"id"`
+	Issued  time.Time `json:"issued"`
+	Expires time.Time `json:"expires"`
+}
+
+type member struct {
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	Notify bool   `json:"notify"`
+}
+
+// Roles of list members, every role grants access of the roles ranked below it
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Scopes of access to a list, members get every scope their role allows
+// and API keys get only scopes they were created with
+const (
+	ScopeListRead    = "list:read"
+	ScopeListWrite   = "list:write"
+	ScopeBOMWrite    = "bom:write"
+	ScopeSchemaWrite = "schema:write"
+	ScopeListAdmin   = "list:admin" //managing members and keys, isn't available for API keys
+)
+
+var scopeRoles = map[string]string{
+	ScopeListRead:    RoleViewer,
+	ScopeListWrite:   RoleEditor,
+	ScopeBOMWrite:    RoleEditor,
+	ScopeSchemaWrite: RoleOwner,
+	ScopeListAdmin:   RoleOwner,
+}
+
+const (
+	inviteLifetime    = 7 * 24 * time.Hour //time after which invitation can't be accepted anymore
+	loginCodeLifetime = 10 * time.Minute   //time after which login code can't be exchanged for a token
+	loginCodeAttempts = 5                  //wrong codes user can enter before the code gets invalidated
+)
+
 func New(databasePool *pgxpool.Pool) *userManager {
 	return &userManager{db: databasePool}
 }
 
 func (u *userManager) Init() error {
-	_, err := u.db.Exec(context.Background(), `CREATE TABLE IF NOT EXISTS users(email TEXT, lists TEXT[])`)
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS users(email TEXT, lists TEXT[])`,
+		`CREATE TABLE IF NOT EXISTS members(id TEXT, email TEXT, role TEXT, UNIQUE (id, email))`,
+		`ALTER TABLE members ADD COLUMN IF NOT EXISTS notify BOOL DEFAULT true`,
+		//only one owner per list, ownership is changed by transfer
+		`CREATE UNIQUE INDEX IF NOT EXISTS members_owner ON members (id) WHERE role = 'owner'`,
+		`CREATE TABLE IF NOT EXISTS invites(code TEXT PRIMARY KEY, id TEXT, email TEXT, role TEXT, created TIMESTAMP)`,
+		`CREATE TABLE IF NOT EXISTS logincodes(email TEXT, hash TEXT, created TIMESTAMP, attempts INT DEFAULT 0, used BOOL DEFAULT false)`,
+		`CREATE TABLE IF NOT EXISTS tokens(jti TEXT PRIMARY KEY, email TEXT, issued TIMESTAMP, expires TIMESTAMP, revoked BOOL DEFAULT false)`,
+		`CREATE TABLE IF NOT EXISTS apikeys(keyid TEXT PRIMARY KEY, id TEXT, name TEXT, hash TEXT, scopes TEXT[], creator TEXT, created TIMESTAMP)`,
+	}
+	for _, table := range tables {
+		if _, err := u.db.Exec(context.Background(), table); err != nil {
+			return err
+		}
+	}
+	//lists used to be stored in users table, every user who had a list in there is its owner
+	_, err := u.db.Exec(context.Background(), `WITH moved AS (UPDATE users SET lists = ARRAY []::TEXT[] WHERE cardinality(lists) > 0 RETURNING email, lists)
+INSERT INTO members (id, email, role) SELECT unnest(lists), email, $1 FROM moved ON CONFLICT DO NOTHING`, RoleOwner)
 	if err != nil {
 		return err
 	}
@@ -40,109 +127,383 @@ func (u *userManager) Init() error {
 	return nil
 }
 
-// Check: checks validity of token
-func (u *userManager) Check(ctx context.Context, id, tokenString string) error {
-	k := func(token *jwt.Token) (interface{}, error) {
-		return []byte(u.Options.SecretKey), nil
+// Check: checks that token is either a token of a member whose role allows given scope in a list
+// or an API key of a list with this scope, returns email of a user or ID of a key
+func (u *userManager) Check(ctx context.Context, id, tokenString, scope string) (string, error) {
+	role, fd := scopeRoles[scope]
+	if !fd {
+		return "", errors.New("unknown scope " + scope)
 	}
-	var user map[string]interface{}
-	tokenToCheck, err := jwt.Parse(tokenString, k)
+	if strings.HasPrefix(tokenString, keyPrefix) {
+		return u.checkKey(ctx, id, tokenString, scope)
+	}
+	email, err := u.CheckWithEmail(ctx, tokenString)
+	if err != nil {
+		return "", err
+	}
+	log.Println("checking token for", email, id)
+	var memberRole string
+	err = u.db.QueryRow(ctx, "SELECT role FROM members WHERE id = $1 AND email = $2", id, email).Scan(&memberRole)
 	if err != nil {
 		log.Println(err.Error())
-		return errors.New("error while verifying access")
+		return "", fmt.Errorf("%w: %s isn't a member of list", ErrForbidden, email)
 	}
-	if claims, ok := tokenToCheck.Claims.(jwt.MapClaims); ok && tokenToCheck.Valid {
-		user = claims
-		var count string
-		log.Println("checking token for", user["email"], id)
-		err = u.db.QueryRow(ctx, "SELECT email from users WHERE email = $1 AND $2 = ANY (lists)", user["email"], id).Scan(&count)
-		if err != nil {
-			log.Println(err.Error())
-			return errors.New("error while verifying access")
-		}
-		return nil
+	if roleRanks[memberRole] < roleRanks[role] {
+		return "", fmt.Errorf("%w: list requires role %s", ErrForbidden, role)
 	}
-	return errors.New("error while verifying access")
+	return email, nil
 }
 
-// New user: links user email to new token, returns jwt token
-func (u *userManager) NewUser(ctx context.Context, email string) (string, error) {
+// RequestCode: sends one time login code to user email, number of codes per hour for one email is limited
+func (u *userManager) RequestCode(ctx context.Context, email string) error {
 	if _, err := mail.ParseAddress(email); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidInput, err)
+	}
+	var sent int
+	err := u.db.QueryRow(ctx, "SELECT count(*) FROM logincodes WHERE email = $1 AND created > $2", email, time.Now().Add(-time.Hour)).Scan(&sent)
+	if err != nil {
+		return err
+	}
+	if sent >= u.Options.LoginCodesPerHour {
+		return fmt.Errorf("%w: too many login codes requested for %s, try again later", ErrTooManyRequests, email)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	_, err = u.db.Exec(ctx, "INSERT INTO logincodes (email, hash, created) VALUES($1, $2, NOW())", email, hashCode(code))
+	if err != nil {
+		return err
+	}
+	return u.NotificationManager.Send(email, []byte("<html><body>"+"Ваш код для входа: "+code+
+		". Код действителен "+fmt.Sprint(loginCodeLifetime.Minutes())+" минут</body></html>"))
+}
+
+// Login: exchanges login code sent to email for a new token, creates user if there isnt one
+func (u *userManager) Login(ctx context.Context, email, code string) (string, error) {
+	var hash string
+	var attempts int
+	//every try counts against the latest code so it can't be guessed
+	err := u.db.QueryRow(ctx, `UPDATE logincodes SET attempts = attempts + 1 WHERE ctid = (SELECT ctid FROM logincodes
+WHERE email = $1 AND NOT used AND created > $2 ORDER BY created DESC LIMIT 1) RETURNING hash, attempts`,
+		email, time.Now().Add(-loginCodeLifetime)).Scan(&hash, &attempts)
+	if err != nil {
+		log.Println(err.Error())
+		return "", fmt.Errorf("%w: no valid login code for %s", ErrUnauthorized, email)
+	}
+	if attempts > loginCodeAttempts || subtle.ConstantTimeCompare([]byte(hash), []byte(hashCode(code))) != 1 {
+		return "", fmt.Errorf("%w: wrong login code", ErrUnauthorized)
+	}
+	_, err = u.db.Exec(ctx, "UPDATE logincodes SET used = true WHERE email = $1", email)
+	if err != nil {
 		return "", err
 	}
-	_, err := u.db.Exec(ctx, "INSERT INTO users (email, lists) VALUES($1, ARRAY []::TEXT[])", email)
+	_, err = u.db.Exec(ctx, `INSERT INTO users (email, lists) SELECT $1, ARRAY []::TEXT[]
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email)
+	if err != nil {
+		return "", err
+	}
+	return u.IssueToken(ctx, email)
+}
+
+// hashCode: login codes and API key secrets are stored only as their hashes
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueToken: signs a new token for email which expires after TokenTTL and saves its ID so it can be revoked
+func (u *userManager) IssueToken(ctx context.Context, email string) (string, error) {
+	jti, err := randomHex(16)
 	if err != nil {
-		return email, errors.New("erros while creating a new user with this email")
+		return "", err
 	}
+	issued := time.Now()
+	expires := issued.Add(u.Options.TokenTTL)
 
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["authorized"] = true
 	claims["email"] = email
+	claims["jti"] = jti
+	claims["iat"] = issued.Unix()
+	claims["exp"] = expires.Unix()
 
 	tokenString, err := token.SignedString([]byte(u.Options.SecretKey))
 	if err != nil {
 		return "", err
 	}
-	err = u.NotificationManager.Send(email, []byte("<html><body>"+"Ваш пароль: "+tokenString+"</body></html>"))
+	_, err = u.db.Exec(ctx, "INSERT INTO tokens (jti, email, issued, expires) VALUES($1, $2, $3, $4)", jti, email, issued, expires)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
-// Add to user lists: adds list ID to to user's available to user
+// parse: verifies token signature, expiry and that it wasn't revoked, returns email and ID of a token
+func (u *userManager) parse(ctx context.Context, tokenString string) (email, jti string, err error) {
+	k := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(u.Options.SecretKey), nil
+	}
+	tokenToCheck, err := jwt.Parse(tokenString, k)
+	if err != nil {
+		return "", "", err
+	}
+	claims, ok := tokenToCheck.Claims.(jwt.MapClaims)
+	if !ok || !tokenToCheck.Valid {
+		return "", "", errors.New("invalid token")
+	}
+	//tokens issued before expiry was introduced live forever, they aren't accepted anymore
+	if _, fd := claims["exp"]; !fd {
+		return "", "", errors.New("token has no expiry")
+	}
+	email = fmt.Sprint(claims["email"])
+	jti = fmt.Sprint(claims["jti"])
+	var revoked bool
+	err = u.db.QueryRow(ctx, "SELECT revoked FROM tokens WHERE jti = $1 AND email = $2", jti, email).Scan(&revoked)
+	if err != nil {
+		return "", "", err
+	}
+	if revoked {
+		return "", "", errors.New("token was revoked")
+	}
+	return email, jti, nil
+}
+
+// RefreshToken: issues a new token in place of a valid one, old token gets revoked
+func (u *userManager) RefreshToken(ctx context.Context, tokenString string) (string, error) {
+	email, jti, err := u.parse(ctx, tokenString)
+	if err != nil {
+		log.Println(err.Error())
+		return "", ErrUnauthorized
+	}
+	newToken, err := u.IssueToken(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if err = u.RevokeToken(ctx, email, jti); err != nil {
+		return "", err
+	}
+	return newToken, nil
+}
+
+// GetTokens: returns every active token of a user as JSON array
+func (u *userManager) GetTokens(ctx context.Context, email string) ([]byte, error) {
+	rows, err := u.db.Query(ctx, "SELECT jti, issued, expires FROM tokens WHERE email = $1 AND NOT revoked AND expires > NOW() ORDER BY issued", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []issuedToken{}
+	for rows.Next() {
+		var t issuedToken
+		if err = rows.Scan(&t.ID, &t.Issued, &t.Expires); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tokens)
+}
+
+// RevokeToken: revokes token of a user with given ID
+func (u *userManager) RevokeToken(ctx context.Context, email, jti string) error {
+	tag, err := u.db.Exec(ctx, "UPDATE tokens SET revoked = true WHERE email = $1 AND jti = $2", email, jti)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: no token with such ID", ErrNotFound)
+	}
+	return nil
+}
+
+// RevokeTokens: revokes every token of a user
+func (u *userManager) RevokeTokens(ctx context.Context, email string) error {
+	_, err := u.db.Exec(ctx, "UPDATE tokens SET revoked = true WHERE email = $1", email)
+	return err
+}
+
+// Add to user lists: makes user an owner of a list
 func (u *userManager) AddToUserLists(ctx context.Context, id, email string) error {
-	_, err := u.db.Exec(ctx, `UPDATE users SET lists = array_append(lists, $1) where email = $2`, id, email)
+	_, err := u.db.Exec(ctx, `INSERT INTO members (id, email, role) VALUES($1, $2, $3)`, id, email, RoleOwner)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// GetUser: Returns email of a user
-func (u *userManager) GetUser(ctx context.Context, id string) (string, error) {
-	rows, err := u.db.Query(ctx, "SELECT email FROM users WHERE $1 = ANY (lists) LIMIT 1", id)
+// GetUsers: returns emails of every list member who wants to get notifications
+func (u *userManager) GetUsers(ctx context.Context, id string) ([]string, error) {
+	rows, err := u.db.Query(ctx, "SELECT email FROM members WHERE id = $1 AND notify", id)
 	if err != nil {
-		return "", nil
+		return nil, err
 	}
-	var email string
+	defer rows.Close()
+	var emails []string
 	for rows.Next() {
+		var email string
 		err = rows.Scan(&email)
 		if err != nil {
 			log.Println(err.Error())
-			return "", err
+			return nil, err
 		}
+		emails = append(emails, email)
 	}
-	return email, nil
+	return emails, rows.Err()
+}
+
+// GetMembers: returns every member of a list with their roles as JSON array
+func (u *userManager) GetMembers(ctx context.Context, id string) ([]byte, error) {
+	rows, err := u.db.Query(ctx, "SELECT email, role, notify FROM members WHERE id = $1 ORDER BY email", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []member{}
+	for rows.Next() {
+		var m member
+		if err = rows.Scan(&m.Email, &m.Role, &m.Notify); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// Invite: creates an invitation to a list for a user and sends its code to user email
+func (u *userManager) Invite(ctx context.Context, id, email, role string) error {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidInput, err)
+	}
+	if _, fd := roleRanks[role]; !fd || role == RoleOwner {
+		return fmt.Errorf("%w: users can be invited only as %s or %s", ErrInvalidInput, RoleViewer, RoleEditor)
+	}
+	code, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	_, err = u.db.Exec(ctx, "INSERT INTO invites (code, id, email, role, created) VALUES($1, $2, $3, $4, NOW())", code, id, email, role)
+	if err != nil {
+		return err
+	}
+	return u.NotificationManager.Send(email, []byte("<html><body>"+"Вас пригласили в список "+id+
+		" с ролью "+role+". Код приглашения: "+code+"</body></html>"))
+}
+
+// AcceptInvite: makes user a list member with role from invitation, returns list ID
+func (u *userManager) AcceptInvite(ctx context.Context, code, email string) (string, error) {
+	var id, role string
+	err := u.db.QueryRow(ctx, "DELETE FROM invites WHERE code = $1 AND email = $2 AND created > $3 RETURNING id, role",
+		code, email, time.Now().Add(-inviteLifetime)).Scan(&id, &role)
+	if err != nil {
+		log.Println(err.Error())
+		return "", fmt.Errorf("%w: no valid invitation with such code for %s", ErrNotFound, email)
+	}
+	//invitation shouldn't downgrade someone who already is a member
+	_, err = u.db.Exec(ctx, `INSERT INTO members (id, email, role) VALUES($1, $2, $3) ON CONFLICT (id, email) DO NOTHING`, id, email, role)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Revoke: removes user from list members along with pending invitations, list owner can't be removed
+func (u *userManager) Revoke(ctx context.Context, id, email string) error {
+	_, err := u.db.Exec(ctx, "DELETE FROM invites WHERE id = $1 AND email = $2", id, email)
+	if err != nil {
+		return err
+	}
+	tag, err := u.db.Exec(ctx, "DELETE FROM members WHERE id = $1 AND email = $2 AND role != $3", id, email, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s isn't a member of list or is its owner", ErrNotFound, email)
+	}
+	return nil
+}
+
+// TransferOwnership: makes another member an owner of a list, previous owner becomes an editor
+func (u *userManager) TransferOwnership(ctx context.Context, id, email string) error {
+	tx, err := u.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE members SET role = $1 WHERE id = $2 AND role = $3", RoleEditor, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, "UPDATE members SET role = $1 WHERE id = $2 AND email = $3", RoleOwner, id, email)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s isn't a member of list", ErrNotFound, email)
+	}
+	return tx.Commit(ctx)
+}
+
+// SetNotify: turns notifications about a list on or off for a member
+func (u *userManager) SetNotify(ctx context.Context, id, email string, notify bool) error {
+	_, err := u.db.Exec(ctx, "UPDATE members SET notify = $1 WHERE id = $2 AND email = $3", notify, id, email)
+	return err
 }
 
 // GetUserIDs: returns all of the user available IDs
 func (u *userManager) GetUserIDs(ctx context.Context, email string) (ids []string, err error) {
-	err = u.db.QueryRow(ctx, "SELECT lists FROM users WHERE email = $1", email).Scan(&ids)
+	err = u.db.QueryRow(ctx, "SELECT array_agg(id) FROM members WHERE email = $1", email).Scan(&ids)
 	if err != nil {
 		return nil, err
 	}
 	if ids == nil {
-		return nil, errors.New("user has no lists available")
+		return nil, fmt.Errorf("%w: user has no lists available", ErrNotFound)
 	}
 	return ids, err
 }
 
 // CheckWithEmail checks jwt token and returns email of a user from token claims. Needed for list generation
 func (u *userManager) CheckWithEmail(ctx context.Context, tokenString string) (string, error) {
-	k := func(token *jwt.Token) (interface{}, error) {
-		return []byte(u.Options.SecretKey), nil
-	}
-	var user map[string]interface{}
-	tokenToCheck, err := jwt.Parse(tokenString, k)
+	email, _, err := u.parse(ctx, tokenString)
 	if err != nil {
 		log.Println(err.Error())
-		return "", errors.New("error while verifying user")
+		return "", ErrUnauthorized
 	}
-	if claims, ok := tokenToCheck.Claims.(jwt.MapClaims); ok && tokenToCheck.Valid {
-		user = claims
-		return fmt.Sprint(user["email"]), nil
+	return email, nil
+}
+
+// CheckAdmin: checks jwt token and returns email of a user if they are an admin of keeper,
+// admins are given in Options as comma separated E-Mails
+func (u *userManager) CheckAdmin(ctx context.Context, tokenString string) (string, error) {
+	email, err := u.CheckWithEmail(ctx, tokenString)
+	if err != nil {
+		return "", err
+	}
+	for _, admin := range strings.Split(u.Options.Admins, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return email, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s isn't an admin of keeper", ErrForbidden, email)
+}
+
+// randomHex: returns hex encoded string of n random bytes
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
-	return "", errors.New("error while verifying user")
+	return hex.EncodeToString(buf), nil
 }
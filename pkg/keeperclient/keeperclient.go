@@ -0,0 +1,660 @@
+// Package keeperclient is a typed client for keeper API described in internal/api/openapi.json,
+// every method corresponds to an operation with the same operationId
+package keeperclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type Client struct {
+	r *resty.Client
+}
+
+// Error: error returned by API, RetryAfter is set when request can be repeated later
+type Error struct {
+	Status     int             `json:"-"`
+	RetryAfter time.Duration   `json:"-"`
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	Details    json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("keeper: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+type Component map[string]string
+
+type List struct {
+	PageNumber int `json:"pageNumber"`
+	PageSize   int `json:"pageSize"`
+	Components []struct {
+		Item      string    `json:"item"`
+		Component Component `json:"component"`
+		Tracking  bool      `json:"tracking"`
+	} `json:"components"`
+}
+
+type Schema struct {
+	ID            string `json:"id"`
+	NameField     string `json:"nameField"`
+	FieldNames    string `json:"fieldNames"`
+	Region        string `json:"region"`
+	MinAmount     string `json:"minimumAmount"`
+	Suppliers     string `json:"suppliers,omitempty"`
+	AmountField   string `json:"amountField,omitempty"`
+	BuildQuantity string `json:"buildQuantity,omitempty"`
+	CheckInterval string `json:"checkInterval,omitempty"`
+	QuietWindow   string `json:"quietWindow,omitempty"`
+	MaxAge        string `json:"maxAge,omitempty"`
+}
+
+type Member struct {
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	Notify bool   `json:"notify"`
+}
+
+type Token struct {
+	ID      string    `json:"id"`
+	Issued  time.Time `json:"issued"`
+	Expires time.Time `json:"expires"`
+}
+
+type Key struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Creator string    `json:"creator"`
+	Created time.Time `json:"created"`
+	Key     string    `json:"key,omitempty"`
+}
+
+// Change: old and new value of a field, nil if there was no value
+type Change struct {
+	Old *string `json:"old"`
+	New *string `json:"new"`
+}
+
+type HistoryEntry struct {
+	Item      string            `json:"item"`
+	Component string            `json:"component"`
+	Changes   map[string]Change `json:"changes"`
+	Actor     string            `json:"actor"`
+	Source    string            `json:"source"`
+	Time      time.Time         `json:"time"`
+}
+
+// Price: price of one piece when at least Quantity pieces are bought
+type Price struct {
+	Quantity int     `json:"quantity"`
+	Unit     float64 `json:"unit"`
+	Currency string  `json:"currency"`
+}
+
+// Availability: stock and price breaks of a part from one check
+type Availability struct {
+	Time         time.Time `json:"time"`
+	Region       string    `json:"region"`
+	Supplier     string    `json:"supplier"`
+	Part         string    `json:"part"`
+	Manufacturer string    `json:"manufacturer"`
+	Stock        *int      `json:"stock"`
+	Price        []Price   `json:"price"`
+}
+
+type SupplierResponse struct {
+	Rows []struct {
+		Name         string  `json:"part"`
+		URL          string  `json:"url"`
+		Manufacturer string  `json:"mfg"`
+		Stock        string  `json:"stock"`
+		Price        []Price `json:"price"`
+	} `json:"rows"`
+	Stockdata struct {
+		Title  string `json:"title"`
+		City   string `json:"city"`
+		Site   string `json:"site"`
+		Email  string `json:"contact_email"`
+		Limits string `json:"min_order"`
+	} `json:"stockdata"`
+	Supplier string `json:"supplier"`
+}
+
+// Region: region of EFind, Parent is empty for countries
+type Region struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Parent   string   `json:"parent"`
+	Children []Region `json:"children"`
+}
+
+type PriceList struct {
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified"`
+}
+
+// CostingLine: the cheapest offer that covers Quantity pieces of a component
+type CostingLine struct {
+	Item         string    `json:"item"`
+	Component    string    `json:"component"`
+	Quantity     int       `json:"quantity"`
+	Supplier     string    `json:"supplier"`
+	Part         string    `json:"part"`
+	Manufacturer string    `json:"manufacturer"`
+	Stock        *int      `json:"stock"`
+	Cost         float64   `json:"cost"`
+	Checked      time.Time `json:"checked"`
+}
+
+// Uncovered: component no offer covers, Reason is not_checked, not_enough_stock or no_price
+type Uncovered struct {
+	Item      string `json:"item"`
+	Component string `json:"component"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+}
+
+// Costing: cost of buying components of a list for Boards boards in Currency
+type Costing struct {
+	ID        string        `json:"id"`
+	Boards    int           `json:"boards"`
+	Currency  string        `json:"currency"`
+	Total     float64       `json:"total"`
+	Suppliers []string      `json:"suppliers"`
+	Lines     []CostingLine `json:"lines"`
+	Uncovered []Uncovered   `json:"uncovered"`
+}
+
+// Metrics: EFind quota usage and scheduler queues, times are in seconds
+type Metrics struct {
+	Quota struct {
+		Quota     int     `json:"quota"`
+		Period    float64 `json:"period"`
+		Burst     int     `json:"burst"`
+		Available float64 `json:"available"`
+		Used      int     `json:"used"`
+		Waited    float64 `json:"waited"`
+		Limited   int     `json:"limited"`
+	} `json:"quota"`
+	Queues struct {
+		Priority int `json:"priority"`
+		Normal   int `json:"normal"`
+		Retry    int `json:"retry"`
+	} `json:"queues"`
+	Checks struct {
+		Done    int `json:"done"`
+		Retried int `json:"retried"`
+		Dropped int `json:"dropped"`
+		Failed  int `json:"failed"`
+	} `json:"checks"`
+}
+
+// Job: work requested through API, either check of components or upload of BOM or batch.
+// Checks have Items and uploads have Format, Rows and Errors, Finished is nil until job is done
+type Job struct {
+	ID       string     `json:"id"`
+	List     string     `json:"list"`
+	Kind     string     `json:"kind"`
+	Actor    string     `json:"actor"`
+	Status   string     `json:"status"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished"`
+	Items    []JobItem  `json:"items,omitempty"`
+	Format   string     `json:"format,omitempty"`
+	Rows     *int       `json:"rows,omitempty"`
+	Errors   []string   `json:"errors,omitempty"`
+}
+
+// JobItem: part of a job, for checks it is a component with its availability state
+type JobItem struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	State  string `json:"state,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Statuses of jobs and their items
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobRetrying  = "retrying"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// CacheStats: usage of cache of supplier offers since start
+type CacheStats struct {
+	Entries    int `json:"entries"`
+	MaxEntries int `json:"maxEntries"`
+	Searching  int `json:"searching"`
+	Hits       int `json:"hits"`
+	Misses     int `json:"misses"`
+	Waited     int `json:"waited"`
+	Stale      int `json:"stale"`
+	Loaded     int `json:"loaded"`
+	Evicted    int `json:"evicted"`
+	Expired    int `json:"expired"`
+	Purged     int `json:"purged"`
+	Suppliers  map[string]struct {
+		Hits   int `json:"hits"`
+		Misses int `json:"misses"`
+	} `json:"suppliers"`
+}
+
+// Roles of list members
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// Scopes of API keys
+const (
+	ScopeListRead    = "list:read"
+	ScopeListWrite   = "list:write"
+	ScopeBOMWrite    = "bom:write"
+	ScopeSchemaWrite = "schema:write"
+)
+
+// New: returns client for API at baseURL, token is either JWT token of a user or API key of a list
+func New(baseURL, token string) *Client {
+	r := resty.New().SetBaseURL(strings.TrimSuffix(baseURL, "/"))
+	if token != "" {
+		r.SetHeader("Token", token)
+	}
+	return &Client{r: r}
+}
+
+// SetToken: replaces token used for requests, for example after refresh
+func (c *Client) SetToken(token string) {
+	c.r.SetHeader("Token", token)
+}
+
+// do: sends request and decodes JSON response into out if it isnt nil
+func (c *Client) do(req *resty.Request, method, url string, out interface{}) (*resty.Response, error) {
+	resp, err := req.Execute(method, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		apiErr := &Error{Status: resp.StatusCode()}
+		if n, err := strconv.Atoi(resp.Header().Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(n) * time.Second
+		}
+		if err = json.Unmarshal(resp.Body(), apiErr); err != nil {
+			apiErr.Message = string(resp.Body())
+		}
+		return nil, apiErr
+	}
+	if out != nil {
+		if err = json.Unmarshal(resp.Body(), out); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/ping", nil)
+	return err
+}
+
+func (c *Client) PingDB(ctx context.Context) error {
+	_, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/pingdb", nil)
+	return err
+}
+
+// GetOpenAPI: returns OpenAPI document of the API
+func (c *Client) GetOpenAPI(ctx context.Context) ([]byte, error) {
+	resp, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body(), nil
+}
+
+// GetRegions: returns region tree, countries go first
+func (c *Client) GetRegions(ctx context.Context) ([]Region, error) {
+	var regions []Region
+	_, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/regions", &regions)
+	return regions, err
+}
+
+func (c *Client) GetMetrics(ctx context.Context) (*Metrics, error) {
+	var metrics Metrics
+	if _, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/metrics", &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+// GetCacheStats: returns usage of cache of supplier offers
+func (c *Client) GetCacheStats(ctx context.Context) (*CacheStats, error) {
+	var stats CacheStats
+	if _, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/cache", &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetJob: returns job, waits up to wait for it to finish if wait isn't zero
+func (c *Client) GetJob(ctx context.Context, jobID string, wait time.Duration) (*Job, error) {
+	var job Job
+	req := c.r.R().SetContext(ctx).SetPathParam("jobId", jobID)
+	if wait > 0 {
+		req.SetQueryParam("wait", wait.String())
+	}
+	if _, err := c.do(req, http.MethodGet, "/api/jobs/{jobId}", &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RequestLoginCode: sends one time login code to email
+func (c *Client) RequestLoginCode(ctx context.Context, email string) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetBody(email), http.MethodPost, "/api/login", nil)
+	return err
+}
+
+// Login: exchanges login code for a token, client starts using it
+func (c *Client) Login(ctx context.Context, email, code string) (string, error) {
+	body := map[string]string{"email": email, "code": code}
+	resp, err := c.do(c.r.R().SetContext(ctx).SetBody(body), http.MethodPost, "/api/login/verify", nil)
+	if err != nil {
+		return "", err
+	}
+	c.SetToken(resp.String())
+	return resp.String(), nil
+}
+
+// RefreshToken: exchanges current token for a new one, client starts using it
+func (c *Client) RefreshToken(ctx context.Context) (string, error) {
+	resp, err := c.do(c.r.R().SetContext(ctx), http.MethodPost, "/api/tokens/refresh", nil)
+	if err != nil {
+		return "", err
+	}
+	c.SetToken(resp.String())
+	return resp.String(), nil
+}
+
+func (c *Client) GetTokens(ctx context.Context) ([]Token, error) {
+	var tokens []Token
+	_, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/tokens", &tokens)
+	return tokens, err
+}
+
+func (c *Client) RevokeToken(ctx context.Context, jti string) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("jti", jti), http.MethodDelete, "/api/tokens/{jti}", nil)
+	return err
+}
+
+func (c *Client) RevokeTokens(ctx context.Context) error {
+	_, err := c.do(c.r.R().SetContext(ctx), http.MethodDelete, "/api/tokens", nil)
+	return err
+}
+
+func (c *Client) GetPriceLists(ctx context.Context) ([]PriceList, error) {
+	var priceLists []PriceList
+	_, err := c.do(c.r.R().SetContext(ctx), http.MethodGet, "/api/pricelists", &priceLists)
+	return priceLists, err
+}
+
+// SavePriceList: uploads CSV or XLSX price list of a supplier
+func (c *Client) SavePriceList(ctx context.Context, name string, priceList io.Reader) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("name", name).SetBody(priceList)
+	_, err := c.do(req, http.MethodPost, "/api/pricelists/{name}", nil)
+	return err
+}
+
+func (c *Client) AcceptInvite(ctx context.Context, code string) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("code", code), http.MethodPost, "/api/invites/{code}", nil)
+	return err
+}
+
+// GetUserLists: returns IDs of every list available to a user with email
+func (c *Client) GetUserLists(ctx context.Context, email string) ([]string, error) {
+	var ids []string
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("email", email), http.MethodGet, "/api/user/{email}", &ids)
+	return ids, err
+}
+
+// NewList: creates a new list and returns its ID
+func (c *Client) NewList(ctx context.Context) (string, error) {
+	resp, err := c.do(c.r.R().SetContext(ctx), http.MethodPost, "/api/list/", nil)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(resp.String())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("keeper: unexpected response %q", resp.String())
+	}
+	return fields[len(fields)-1], nil
+}
+
+// GetList: returns page of a list, components that aren't tracked are included only if all is true
+func (c *Client) GetList(ctx context.Context, id string, pageNum, pageSize int, all bool) (*List, error) {
+	var list List
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).
+		SetQueryParam("pageNum", strconv.Itoa(pageNum)).SetQueryParam("pageSize", strconv.Itoa(pageSize)).
+		SetQueryParam("all", strconv.FormatBool(all))
+	_, err := c.do(req, http.MethodGet, "/api/list/{id}", &list)
+	return &list, err
+}
+
+func (c *Client) AddItem(ctx context.Context, id string, component Component) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(component), http.MethodPost, "/api/list/{id}", nil)
+	return err
+}
+
+func (c *Client) UntrackItem(ctx context.Context, id string, component Component) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(component), http.MethodPut, "/api/list/{id}", nil)
+	return err
+}
+
+// EditItem: changes given fields of an item, other fields stay the same
+func (c *Client) EditItem(ctx context.Context, id, itemID string, fields Component) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("itemId", itemID).SetBody(fields)
+	_, err := c.do(req, http.MethodPatch, "/api/list/{id}/items/{itemId}", nil)
+	return err
+}
+
+// DeleteItem: removes an item from a list for good
+func (c *Client) DeleteItem(ctx context.Context, id, itemID string) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("itemId", itemID)
+	_, err := c.do(req, http.MethodDelete, "/api/list/{id}/items/{itemId}", nil)
+	return err
+}
+
+// TrackItem: starts tracking an item again
+func (c *Client) TrackItem(ctx context.Context, id, itemID string) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("itemId", itemID)
+	_, err := c.do(req, http.MethodPost, "/api/list/{id}/items/{itemId}/track", nil)
+	return err
+}
+
+// CheckItem: checks tracked components of an item right away, returns ID of a job to follow with GetJob
+func (c *Client) CheckItem(ctx context.Context, id, itemID string) (string, error) {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("itemId", itemID)
+	return c.postJob(req, "/api/list/{id}/items/{itemId}/check")
+}
+
+// PurgeItemCache: removes cached offers for tracked components of an item so they are searched for again
+func (c *Client) PurgeItemCache(ctx context.Context, id, itemID string) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("itemId", itemID)
+	_, err := c.do(req, http.MethodDelete, "/api/list/{id}/items/{itemId}/cache", nil)
+	return err
+}
+
+// GetAvailability: returns results of every check of an item, item is either its ID or component name,
+// region and zero times aren't used as filters
+func (c *Client) GetAvailability(ctx context.Context, id, item, region string, from, to time.Time) ([]Availability, error) {
+	var history []Availability
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("itemId", item)
+	if region != "" {
+		req.SetQueryParam("region", region)
+	}
+	if !from.IsZero() {
+		req.SetQueryParam("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		req.SetQueryParam("to", to.Format(time.RFC3339))
+	}
+	_, err := c.do(req, http.MethodGet, "/api/list/{id}/items/{itemId}/history", &history)
+	return history, err
+}
+
+func (c *Client) GetSchema(ctx context.Context, id string) (*Schema, error) {
+	var schema Schema
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id), http.MethodGet, "/api/list/{id}/schema", &schema)
+	return &schema, err
+}
+
+func (c *Client) SaveSchema(ctx context.Context, id string, schema *Schema) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(schema), http.MethodPost, "/api/list/{id}/schema", nil)
+	return err
+}
+
+// UploadBOM: queues every component from csv BOM file, returns ID of a job to follow with GetJob
+func (c *Client) UploadBOM(ctx context.Context, id string, bom io.Reader) (string, error) {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetHeader("Content-Type", "text/csv").SetBody(bom)
+	return c.postJob(req, "/api/list/{id}/bom")
+}
+
+// UploadBatch: queues every component from array, returns ID of a job to follow with GetJob
+func (c *Client) UploadBatch(ctx context.Context, id string, components []Component) (string, error) {
+	return c.postJob(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(components), "/api/list/{id}/batch")
+}
+
+func (c *Client) GetMembers(ctx context.Context, id string) ([]Member, error) {
+	var members []Member
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id), http.MethodGet, "/api/list/{id}/members", &members)
+	return members, err
+}
+
+func (c *Client) RevokeMember(ctx context.Context, id, email string) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("email", email)
+	_, err := c.do(req, http.MethodDelete, "/api/list/{id}/members/{email}", nil)
+	return err
+}
+
+func (c *Client) Invite(ctx context.Context, id, email, role string) error {
+	body := map[string]string{"email": email, "role": role}
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(body), http.MethodPost, "/api/list/{id}/invites", nil)
+	return err
+}
+
+func (c *Client) TransferOwnership(ctx context.Context, id, email string) error {
+	body := map[string]string{"email": email}
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(body), http.MethodPost, "/api/list/{id}/owner", nil)
+	return err
+}
+
+func (c *Client) SetNotify(ctx context.Context, id string, notify bool) error {
+	body := map[string]bool{"notify": notify}
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(body), http.MethodPut, "/api/list/{id}/notifications", nil)
+	return err
+}
+
+// GetHistory: returns changes of list items, component and zero times aren't used as filters
+func (c *Client) GetHistory(ctx context.Context, id, component string, from, to time.Time) ([]HistoryEntry, error) {
+	var history []HistoryEntry
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id)
+	if component != "" {
+		req.SetQueryParam("component", component)
+	}
+	if !from.IsZero() {
+		req.SetQueryParam("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		req.SetQueryParam("to", to.Format(time.RFC3339))
+	}
+	_, err := c.do(req, http.MethodGet, "/api/list/{id}/history", &history)
+	return history, err
+}
+
+// GetCosting: returns cost of buying components of a list for boards, build quantity of a list is used if boards is zero
+func (c *Client) GetCosting(ctx context.Context, id string, boards int) (*Costing, error) {
+	var costing Costing
+	_, err := c.do(costingRequest(c.r.R().SetContext(ctx).SetPathParam("id", id), boards), http.MethodGet, "/api/list/{id}/costing", &costing)
+	if err != nil {
+		return nil, err
+	}
+	return &costing, nil
+}
+
+// GetCostingCSV: returns the same costing as GetCosting as CSV
+func (c *Client) GetCostingCSV(ctx context.Context, id string, boards int) ([]byte, error) {
+	req := costingRequest(c.r.R().SetContext(ctx).SetPathParam("id", id), boards).SetQueryParam("format", "csv")
+	resp, err := c.do(req, http.MethodGet, "/api/list/{id}/costing", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body(), nil
+}
+
+func costingRequest(req *resty.Request, boards int) *resty.Request {
+	if boards > 0 {
+		req.SetQueryParam("boards", strconv.Itoa(boards))
+	}
+	return req
+}
+
+// CheckList: checks tracked components of a list right away, returns ID of a job to follow with GetJob
+func (c *Client) CheckList(ctx context.Context, id string) (string, error) {
+	return c.postJob(c.r.R().SetContext(ctx).SetPathParam("id", id), "/api/list/{id}/check")
+}
+
+// PurgeCache: removes cached offers for tracked components of a list so they are searched for again
+func (c *Client) PurgeCache(ctx context.Context, id string) error {
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id), http.MethodDelete, "/api/list/{id}/cache", nil)
+	return err
+}
+
+func (c *Client) postJob(req *resty.Request, url string) (string, error) {
+	var output struct {
+		Job string `json:"job"`
+	}
+	if _, err := c.do(req, http.MethodPost, url, &output); err != nil {
+		return "", err
+	}
+	return output.Job, nil
+}
+
+func (c *Client) GetKeys(ctx context.Context, id string) ([]Key, error) {
+	var keys []Key
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id), http.MethodGet, "/api/list/{id}/keys", &keys)
+	return keys, err
+}
+
+// NewKey: creates API key for a list, Key field of result is the only place key can be seen
+func (c *Client) NewKey(ctx context.Context, id, name string, scopes ...string) (*Key, error) {
+	var key Key
+	body := map[string]interface{}{"name": name, "scopes": scopes}
+	_, err := c.do(c.r.R().SetContext(ctx).SetPathParam("id", id).SetBody(body), http.MethodPost, "/api/list/{id}/keys", &key)
+	return &key, err
+}
+
+func (c *Client) DeleteKey(ctx context.Context, id, keyID string) error {
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("keyId", keyID)
+	_, err := c.do(req, http.MethodDelete, "/api/list/{id}/keys/{keyId}", nil)
+	return err
+}
+
+// GetCached: returns latest responses of suppliers for a component
+func (c *Client) GetCached(ctx context.Context, id, name string) ([]SupplierResponse, error) {
+	var data []SupplierResponse
+	req := c.r.R().SetContext(ctx).SetPathParam("id", id).SetPathParam("name", name)
+	_, err := c.do(req, http.MethodGet, "/api/list/{id}/{name}", &data)
+	return data, err
+}
@@ -0,0 +1,33 @@
+package keeperclient
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Operations: client should have a method for every operation from OpenAPI document
+func Test_Operations(t *testing.T) {
+	body, err := os.ReadFile("../../internal/api/openapi.json")
+	require.NoError(t, err)
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(body, &doc))
+
+	client := reflect.TypeOf(&Client{})
+	for path, methods := range doc.Paths {
+		for method, op := range methods {
+			name := strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+			_, fd := client.MethodByName(name)
+			assert.True(t, fd, "client has no method %s for %s %s", name, method, path)
+		}
+	}
+}